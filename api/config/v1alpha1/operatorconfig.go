@@ -0,0 +1,214 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// TLS versions of backend.tls.minVersion
+var tlsVersions = []string{"1.0", "1.1", "1.2", "1.3"}
+
+// Docker access methods of dockerRegistry.accessMethod
+var dockerAccessMethods = []string{"repositoryPath", "subdomain", "port"}
+
+// Placeholders in the naming templates
+const (
+	namePlaceholder     = "{name}"
+	repotypePlaceholder = "{repotype}"
+)
+
+// Load reads and validates the operator configuration file, unknown fields are rejected
+func Load(path string) (*OperatorConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading operator config: %w", err)
+	}
+	config := &OperatorConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parsing operator config %s: %w", path, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid operator config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Validate checks the version of the configuration and every setting in it
+func (c *OperatorConfig) Validate() error {
+	errs := []string{}
+	if c.APIVersion != GroupVersion.String() || c.Kind != Kind {
+		errs = append(errs, fmt.Sprintf("apiVersion and kind must be %s and %s", GroupVersion.String(), Kind))
+	}
+	errs = append(errs, c.Backend.validate()...)
+	errs = append(errs, c.Naming.validate()...)
+	errs = append(errs, c.ServiceAccounts.validate()...)
+	errs = append(errs, c.DockerRegistry.validate()...)
+	repotypes := []string{}
+	for repotype := range c.RepositoryDefaults {
+		repotypes = append(repotypes, repotype)
+	}
+	sort.Strings(repotypes)
+	for _, repotype := range repotypes {
+		if !isSupportedRepotype(repotype) {
+			errs = append(errs, fmt.Sprintf("repositoryDefaults: repotype %q is not supported", repotype))
+		}
+	}
+	errs = append(errs, c.PasswordPolicy.validate()...)
+	errs = append(errs, c.Controller.validate()...)
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (b *BackendConfig) validate() []string {
+	errs := []string{}
+	if b.URL != "" {
+		if u, err := url.Parse(b.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("backend.url %q must be an http or https url", b.URL))
+		}
+	}
+	if s := b.CredentialsSecret; s != nil {
+		if msgs := validation.IsDNS1123Label(s.Namespace); len(msgs) > 0 {
+			errs = append(errs, "backend.credentialsSecret.namespace must be a valid namespace: "+strings.Join(msgs, ", "))
+		}
+		if msgs := validation.IsDNS1123Subdomain(s.Name); len(msgs) > 0 {
+			errs = append(errs, "backend.credentialsSecret.name must be a valid secret name: "+strings.Join(msgs, ", "))
+		}
+	}
+	if (b.TLS.CertFile == "") != (b.TLS.KeyFile == "") {
+		errs = append(errs, "backend.tls.certFile and backend.tls.keyFile must be set together")
+	}
+	if b.TLS.MinVersion != "" && !contains(tlsVersions, b.TLS.MinVersion) {
+		errs = append(errs, fmt.Sprintf("backend.tls.minVersion %q must be one of %s", b.TLS.MinVersion, strings.Join(tlsVersions, ", ")))
+	}
+	if b.Proxy.URL != "" {
+		if u, err := url.Parse(b.Proxy.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			errs = append(errs, "backend.proxy.url must be an http, https or socks5 url")
+		}
+	}
+	for _, namespace := range b.DebugNamespaces {
+		if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+			errs = append(errs, fmt.Sprintf("backend.debugNamespaces: %q must be a valid namespace: %s", namespace, strings.Join(msgs, ", ")))
+		}
+	}
+	errs = appendIfNegativeDuration(errs, "backend.requestTimeout", b.RequestTimeout)
+	errs = appendIfNegative(errs, "backend.maxRetries", b.MaxRetries)
+	errs = appendIfNegative(errs, "backend.rateLimit", b.RateLimit)
+	if b.RateBurst != nil && *b.RateBurst < 1 {
+		errs = append(errs, "backend.rateBurst must be at least 1")
+	}
+	return errs
+}
+
+func (n *NamingConfig) validate() []string {
+	errs := []string{}
+	if n.User != "" && !strings.Contains(n.User, namePlaceholder) {
+		errs = append(errs, "naming.user must contain "+namePlaceholder)
+	}
+	if n.PermissionTarget != "" && (!strings.Contains(n.PermissionTarget, namePlaceholder) || !strings.Contains(n.PermissionTarget, repotypePlaceholder)) {
+		errs = append(errs, "naming.permissionTarget must contain "+namePlaceholder+" and "+repotypePlaceholder)
+	}
+	if n.Group != "" && !strings.Contains(n.Group, namePlaceholder) {
+		errs = append(errs, "naming.group must contain "+namePlaceholder)
+	}
+	if n.Secret != "" {
+		if !strings.Contains(n.Secret, namePlaceholder) {
+			errs = append(errs, "naming.secret must contain "+namePlaceholder)
+		} else if msgs := validation.IsDNS1123Subdomain(strings.Replace(n.Secret, namePlaceholder, "name", -1)); len(msgs) > 0 {
+			errs = append(errs, "naming.secret must give a valid secret name: "+strings.Join(msgs, ", "))
+		}
+	}
+	return errs
+}
+
+func (s *ServiceAccountsConfig) validate() []string {
+	errs := []string{}
+	errs = appendIfInvalidServiceAccount(errs, "serviceAccounts.imagePull", s.ImagePull)
+	errs = appendIfInvalidServiceAccount(errs, "serviceAccounts.builder", s.Builder)
+	return errs
+}
+
+func (d *DockerRegistryConfig) validate() []string {
+	errs := []string{}
+	if d.AccessMethod != "" && !contains(dockerAccessMethods, d.AccessMethod) {
+		errs = append(errs, fmt.Sprintf("dockerRegistry.accessMethod %q must be one of %s", d.AccessMethod, strings.Join(dockerAccessMethods, ", ")))
+	}
+	for _, host := range d.Hosts {
+		if u, err := url.Parse("//" + host); err != nil || u.Host != host || u.Hostname() == "" {
+			errs = append(errs, fmt.Sprintf("dockerRegistry.hosts: %q must be a host name with an optional port", host))
+		}
+	}
+	return errs
+}
+
+func appendIfInvalidServiceAccount(errs []string, field string, name string) []string {
+	if name == "" {
+		return errs
+	}
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+		errs = append(errs, field+" must be a valid service account name: "+strings.Join(msgs, ", "))
+	}
+	return errs
+}
+
+func (p *PasswordPolicyConfig) validate() []string {
+	errs := []string{}
+	errs = appendIfNegative(errs, "passwordPolicy.length", p.Length)
+	errs = appendIfNegative(errs, "passwordPolicy.minUpper", p.MinUpper)
+	errs = appendIfNegative(errs, "passwordPolicy.minLower", p.MinLower)
+	errs = appendIfNegative(errs, "passwordPolicy.minDigits", p.MinDigits)
+	errs = appendIfNegative(errs, "passwordPolicy.minSpecial", p.MinSpecial)
+	return errs
+}
+
+func (c *ControllerConfig) validate() []string {
+	errs := []string{}
+	errs = appendIfNegativeDuration(errs, "controller.resyncInterval", c.ResyncInterval)
+	errs = appendIfNegativeDuration(errs, "controller.reconcileTimeout", c.ReconcileTimeout)
+	if c.MaxConcurrentReconciles != nil && *c.MaxConcurrentReconciles < 1 {
+		errs = append(errs, "controller.maxConcurrentReconciles must be at least 1")
+	}
+	errs = appendIfNegative(errs, "controller.maxConcurrentReconcilesPerNamespace", c.MaxConcurrentReconcilesPerNamespace)
+	errs = appendIfNegativeDuration(errs, "controller.requeueBaseDelay", c.RequeueBaseDelay)
+	errs = appendIfNegativeDuration(errs, "controller.requeueMaxDelay", c.RequeueMaxDelay)
+	if c.RequeueBaseDelay != nil && c.RequeueMaxDelay != nil && c.RequeueBaseDelay.Duration > c.RequeueMaxDelay.Duration {
+		errs = append(errs, "controller.requeueBaseDelay must not be longer than controller.requeueMaxDelay")
+	}
+	return errs
+}
+
+func appendIfNegative(errs []string, field string, value *int) []string {
+	if value != nil && *value < 0 {
+		errs = append(errs, field+" must not be negative")
+	}
+	return errs
+}
+
+func appendIfNegativeDuration(errs []string, field string, value *metav1.Duration) []string {
+	if value != nil && value.Duration < 0 {
+		errs = append(errs, field+" must not be negative")
+	}
+	return errs
+}
+
+func isSupportedRepotype(repotype string) bool {
+	return contains(repositoryv1beta1.SupportedRepotypes, repotype)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
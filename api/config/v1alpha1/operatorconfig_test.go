@@ -0,0 +1,76 @@
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadSample(t *testing.T) {
+	config, err := Load("../../../config/samples/config_v1alpha1_operatorconfig.yaml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if config.Backend.URL != "https://artifactory.example.com/artifactory" || !config.Backend.TLS.VerifySSL {
+		t.Errorf("Load() backend = %+v", config.Backend)
+	}
+	if config.Controller.ResyncInterval == nil || config.Controller.ResyncInterval.Duration != 10*time.Minute {
+		t.Errorf("Load() resyncInterval = %v, want 10m", config.Controller.ResyncInterval)
+	}
+	if d := config.RepositoryDefaults["npm"]; d.XrayIndex == nil || *d.XrayIndex {
+		t.Errorf("Load() npm defaults = %+v, want xrayIndex false", d)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	header := "apiVersion: config.repository.storage.sebshift.io/v1alpha1\nkind: OperatorConfig\n"
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{name: "Test an empty config keeps every default", config: header},
+		{name: "Test the version is required", config: "kind: OperatorConfig\n", wantErr: "apiVersion and kind"},
+		{name: "Test unknown fields are rejected", config: header + "backend:\n  uri: https://artifactory\n", wantErr: "unknown field"},
+		{name: "Test the url must be absolute", config: header + "backend:\n  url: artifactory/api\n", wantErr: "backend.url"},
+		{name: "Test the credentials secret needs a namespace", config: header + "backend:\n  credentialsSecret:\n    name: repo-operator-repo-secret\n", wantErr: "backend.credentialsSecret.namespace"},
+		{name: "Test the client key is required with the certificate", config: header + "backend:\n  tls:\n    certFile: /etc/artifactory/tls.crt\n", wantErr: "backend.tls.certFile"},
+		{name: "Test the TLS version must be known", config: header + "backend:\n  tls:\n    minVersion: \"1.4\"\n", wantErr: "backend.tls.minVersion"},
+		{name: "Test the proxy must be a url", config: header + "backend:\n  proxy:\n    url: proxy.example.com:3128\n", wantErr: "backend.proxy.url"},
+		{name: "Test the debug namespaces must be namespaces", config: header + "backend:\n  debugNamespaces: [Tenant_A]\n", wantErr: "backend.debugNamespaces"},
+		{name: "Test password minimums must not be negative", config: header + "passwordPolicy:\n  minDigits: -1\n", wantErr: "passwordPolicy.minDigits"},
+		{name: "Test durations must not be negative", config: header + "controller:\n  resyncInterval: -1m\n", wantErr: "controller.resyncInterval"},
+		{name: "Test the user template needs the name", config: header + "naming:\n  user: repo-user\n", wantErr: "naming.user"},
+		{name: "Test the permission target template needs the repotype", config: header + "naming:\n  permissionTarget: \"{name}-permission\"\n", wantErr: "naming.permissionTarget"},
+		{name: "Test the group template needs the name", config: header + "naming:\n  group: repo-group\n", wantErr: "naming.group"},
+		{name: "Test the secret template must give a secret name", config: header + "naming:\n  secret: \"{name}_Secret\"\n", wantErr: "naming.secret"},
+		{name: "Test service accounts must be valid names", config: header + "serviceAccounts:\n  builder: Builder\n", wantErr: "serviceAccounts.builder"},
+		{name: "Test the docker access method must be known", config: header + "dockerRegistry:\n  accessMethod: path\n", wantErr: "dockerRegistry.accessMethod"},
+		{name: "Test the registry hosts must be host names", config: header + "dockerRegistry:\n  hosts: [\"https://registry.example.com\"]\n", wantErr: "dockerRegistry.hosts"},
+		{name: "Test repository defaults must be for a supported repotype", config: header + "repositoryDefaults:\n  helm:\n    xrayIndex: false\n", wantErr: "repotype \"helm\""},
+		{name: "Test the requeue delays must be ordered", config: header + "controller:\n  requeueBaseDelay: 10m\n  requeueMaxDelay: 1m\n", wantErr: "controller.requeueBaseDelay"},
+	}
+	dir, err := ioutil.TempDir("", "operatorconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config"+string(rune('a'+i))+".yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Load() error = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 contains the configuration file of the operator
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupVersion is the apiVersion of the operator configuration file
+var GroupVersion = schema.GroupVersion{Group: "config.repository.storage.sebshift.io", Version: "v1alpha1"}
+
+// Kind of the operator configuration file
+const Kind = "OperatorConfig"
+
+// OperatorConfig is the configuration file of the operator.
+// Every setting is optional, a setting which is left out keeps the built-in default or the value of its flag.
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Backend is the Artifactory instance the repositories are managed in
+	Backend BackendConfig `json:"backend,omitempty"`
+
+	// Naming holds the templates for the names of the objects created for a Repository
+	Naming NamingConfig `json:"naming,omitempty"`
+
+	// ServiceAccounts are the service accounts the docker config secret is linked to
+	ServiceAccounts ServiceAccountsConfig `json:"serviceAccounts,omitempty"`
+
+	// DockerRegistry describes how Artifactory serves the docker repositories
+	DockerRegistry DockerRegistryConfig `json:"dockerRegistry,omitempty"`
+
+	// RepositoryDefaults are the settings of the local repositories by repotype
+	RepositoryDefaults map[string]RepositoryDefaults `json:"repositoryDefaults,omitempty"`
+
+	// PasswordPolicy describes the passwords generated for the users of docker Repositories
+	PasswordPolicy PasswordPolicyConfig `json:"passwordPolicy,omitempty"`
+
+	// Controller holds the settings of the Repository controller
+	Controller ControllerConfig `json:"controller,omitempty"`
+}
+
+// BackendConfig is the connection to Artifactory. The credentials are never read from the file, they are taken
+// from the credentials secret or the REPOSITORY_USERNAME and REPOSITORY_PASSWORD or REPOSITORY_TOKEN environment variables.
+type BackendConfig struct {
+	// URL of Artifactory, e.g. https://artifactory.example.com/artifactory
+	URL string `json:"url,omitempty"`
+
+	// CredentialsSecret is the secret with the url, username and password or token and CA bundle of Artifactory.
+	// It's watched, the client is replaced when the secret changes. Its keys take precedence over the other settings.
+	CredentialsSecret *SecretReference `json:"credentialsSecret,omitempty"`
+
+	// RequestTimeout is the time limit for a single request including its retries, 0s means no limit
+	RequestTimeout *metav1.Duration `json:"requestTimeout,omitempty"`
+
+	// MaxRetries is how often an idempotent request is retried after a transient failure
+	MaxRetries *int `json:"maxRetries,omitempty"`
+
+	// RateLimit is the number of requests per second sent to Artifactory, 0 means no limit
+	RateLimit *int `json:"rateLimit,omitempty"`
+
+	// RateBurst is the number of requests which may be sent at once before the rate limit applies
+	RateBurst *int `json:"rateBurst,omitempty"`
+
+	// Debug logs the requests with their redacted headers and bodies, and the status and latency of the responses
+	Debug bool `json:"debug,omitempty"`
+
+	// DebugNamespaces enables the debug log only for the requests of the Repositories in these namespaces
+	DebugNamespaces []string `json:"debugNamespaces,omitempty"`
+
+	// TLS holds the settings for https connections to Artifactory
+	TLS TLSConfig `json:"tls,omitempty"`
+
+	// Proxy is the proxy for the requests to Artifactory
+	Proxy ProxyConfig `json:"proxy,omitempty"`
+}
+
+// SecretReference names a secret
+type SecretReference struct {
+	// Namespace of the secret
+	Namespace string `json:"namespace"`
+
+	// Name of the secret
+	Name string `json:"name"`
+}
+
+// TLSConfig holds the settings for https connections to Artifactory
+type TLSConfig struct {
+	// VerifySSL verifies the certificate of Artifactory. It's off by default for compatibility with earlier releases,
+	// a CA bundle turns it on.
+	VerifySSL bool `json:"verifySSL,omitempty"`
+
+	// CAFile is a PEM bundle of the certificate authorities trusted for Artifactory, the system pool is used when empty
+	CAFile string `json:"caFile,omitempty"`
+
+	// CertFile and KeyFile are the PEM certificate and key presented to Artifactory for mutual TLS
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+
+	// MinVersion is the lowest TLS version accepted, one of 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `json:"minVersion,omitempty"`
+}
+
+// ProxyConfig is the proxy for the requests to Artifactory. The HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment
+// variables are used for the settings which are left out.
+type ProxyConfig struct {
+	// URL of the proxy, e.g. http://proxy.example.com:3128
+	URL string `json:"url,omitempty"`
+
+	// NoProxy lists the hosts which are reached without the proxy, in the NO_PROXY format
+	NoProxy string `json:"noProxy,omitempty"`
+}
+
+// NamingConfig holds the templates for the names of the objects created for a Repository.
+// {name} is replaced with the name of the Repository and {repotype} with its repotype.
+// The repository keys are always <name>-<repotype>[-snapshot|-release][-local].
+type NamingConfig struct {
+	// User is the Artifactory user of a docker Repository, it must contain {name}
+	User string `json:"user,omitempty"`
+
+	// PermissionTarget is the Artifactory permission target, it must contain {name} and {repotype}
+	PermissionTarget string `json:"permissionTarget,omitempty"`
+
+	// Group is the Artifactory group the access tokens of a docker Repository are scoped to, it must contain {name}
+	Group string `json:"group,omitempty"`
+
+	// Secret is the docker config secret of a docker Repository, it must contain {name}
+	Secret string `json:"secret,omitempty"`
+}
+
+// ServiceAccountsConfig are the service accounts of the namespace the docker config secret is linked to
+type ServiceAccountsConfig struct {
+	// ImagePull gets the secret as image pull secret
+	ImagePull string `json:"imagePull,omitempty"`
+
+	// Builder gets the secret to push images
+	Builder string `json:"builder,omitempty"`
+}
+
+// DockerRegistryConfig describes how Artifactory serves the docker repositories, it decides the registry hosts
+// in the docker config secret
+type DockerRegistryConfig struct {
+	// AccessMethod is the docker access method of Artifactory, one of repositoryPath (the default), subdomain or port.
+	// With port the port of a Repository is taken from its repository.storage.sebshift.io/registry-port annotation.
+	AccessMethod string `json:"accessMethod,omitempty"`
+
+	// Hosts are the host names of the registry, e.g. an internal and an external one, with an optional port.
+	// The host of the Artifactory url is used when it's empty.
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// RepositoryDefaults are the settings of the local repositories of a repotype
+type RepositoryDefaults struct {
+	// LayoutRef is the repository layout
+	LayoutRef string `json:"layoutRef,omitempty"`
+
+	// XrayIndex enables the indexing by Xray
+	XrayIndex *bool `json:"xrayIndex,omitempty"`
+}
+
+// PasswordPolicyConfig describes the passwords generated for the users of docker Repositories.
+// The settings which are left out keep the default policy of 24 characters with at least one of every class.
+type PasswordPolicyConfig struct {
+	// Length of the password, at least 12
+	Length *int `json:"length,omitempty"`
+
+	// MinUpper, MinLower, MinDigits and MinSpecial are the least number of characters of each class
+	MinUpper   *int `json:"minUpper,omitempty"`
+	MinLower   *int `json:"minLower,omitempty"`
+	MinDigits  *int `json:"minDigits,omitempty"`
+	MinSpecial *int `json:"minSpecial,omitempty"`
+
+	// Specials are the special characters to use. Quotes, backslashes, backticks, $, :, ; and whitespace aren't allowed,
+	// they break the docker config or shell scripts.
+	Specials string `json:"specials,omitempty"`
+
+	// Exclude are characters which are never used, e.g. ones which are easily confused
+	Exclude string `json:"exclude,omitempty"`
+}
+
+// ControllerConfig holds the settings of the Repository controller
+type ControllerConfig struct {
+	// ResyncInterval is how often every Repository is reconciled to detect drift in Artifactory, 0s disables the resync
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty"`
+
+	// CorrectDrift re-applies the desired configuration when drift is detected
+	CorrectDrift *bool `json:"correctDrift,omitempty"`
+
+	// ReconcileTimeout is the deadline for a single reconcile, 0s disables the deadline
+	ReconcileTimeout *metav1.Duration `json:"reconcileTimeout,omitempty"`
+
+	// MaxConcurrentReconciles is the number of Repositories reconciled at the same time
+	MaxConcurrentReconciles *int `json:"maxConcurrentReconciles,omitempty"`
+
+	// MaxConcurrentReconcilesPerNamespace is the number of workers a single namespace may use, 0 disables the limit
+	MaxConcurrentReconcilesPerNamespace *int `json:"maxConcurrentReconcilesPerNamespace,omitempty"`
+
+	// RequeueBaseDelay is the delay before a failed Repository is reconciled again
+	RequeueBaseDelay *metav1.Duration `json:"requeueBaseDelay,omitempty"`
+
+	// RequeueMaxDelay is the longest delay before a failing Repository is reconciled again
+	RequeueMaxDelay *metav1.Duration `json:"requeueMaxDelay,omitempty"`
+}
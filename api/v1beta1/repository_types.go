@@ -29,8 +29,73 @@ type RepositorySpec struct {
 
 	Repotype string   `json:"repotype,omitempty"`
 	Users    []string `json:"users,omitempty"`
+	// Adopt takes over repositories that already exist in Artifactory instead of reporting a conflict,
+	// as long as their package type and layout match
+	// +optional
+	Adopt bool `json:"adopt,omitempty"`
+	// DeletionPolicy decides what happens to the Artifactory objects when the Repository is deleted, defaults to Delete
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Credentials configures the credentials in the docker config secret of a docker Repository
+	// +optional
+	Credentials *CredentialsSpec `json:"credentials,omitempty"`
 }
 
+// CredentialsSpec configures the credentials in the docker config secret of a docker Repository
+type CredentialsSpec struct {
+	// RotationInterval is how often the password of the repository user or the access token and the docker config
+	// secret are renewed, unset or 0s never renews them
+	// +optional
+	RotationInterval *metav1.Duration `json:"rotationInterval,omitempty"`
+	// Type of the credentials, defaults to User
+	// +optional
+	Type CredentialsType `json:"type,omitempty"`
+	// TokenLifetime is how long an access token is valid, defaults to 24h. The token is renewed when a third of
+	// its lifetime is left.
+	// +optional
+	TokenLifetime *metav1.Duration `json:"tokenLifetime,omitempty"`
+}
+
+// CredentialsType describes the credentials in the docker config secret of a docker Repository
+// +kubebuilder:validation:Enum=User;AccessToken
+type CredentialsType string
+
+const (
+	// CredentialsTypeUser creates an internal Artifactory user with a password for the Repository
+	CredentialsTypeUser CredentialsType = "User"
+	// CredentialsTypeAccessToken issues expiring access tokens scoped to a group of the Repository
+	CredentialsTypeAccessToken CredentialsType = "AccessToken"
+)
+
+// DebugAnnotation set to "true" logs the Artifactory requests of the Repository with their redacted headers and bodies,
+// "false" turns the debug log off for a Repository in a debug namespace
+const DebugAnnotation = "repository.storage.sebshift.io/debug"
+
+// RotateCredentialsAnnotation renews the credentials of a docker Repository now, whenever its value changes,
+// e.g. to the current time
+const RotateCredentialsAnnotation = "repository.storage.sebshift.io/rotate-credentials"
+
+// RegistryPortAnnotation is the port the docker registry of a docker Repository is served on, when Artifactory
+// serves every docker repository on a port of its own
+const RegistryPortAnnotation = "repository.storage.sebshift.io/registry-port"
+
+// MigrateRepotypeAnnotation set to "true" allows changing the repotype of a Repository with the Delete policy,
+// which deletes the previous repositories with every artifact
+const MigrateRepotypeAnnotation = "repository.storage.sebshift.io/migrate-repotype"
+
+// DeletionPolicy describes what happens to the Artifactory objects of a deleted Repository
+// +kubebuilder:validation:Enum=Delete;Retain;Archive
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the repositories with every artifact, the users and the permission target
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain leaves every Artifactory object in place and only unlinks the cluster wiring
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyArchive blacks out the repositories and removes the permission target so the data can be recovered
+	DeletionPolicyArchive DeletionPolicy = "Archive"
+)
+
 // RepositoryStatus defines the observed state of Repository
 type RepositoryStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -39,11 +104,68 @@ type RepositoryStatus struct {
 	Repourl    string `json:"repourl,omitempty"`
 	State      string `json:"state,omitempty"`
 	Statuscode int    `json:"statuscode,omitempty"`
+
+	// ObservedGeneration is the most recent generation observed by the operator
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ProvisionedRepotype is the repotype the repositories in Artifactory were provisioned for
+	ProvisionedRepotype string `json:"provisionedRepotype,omitempty"`
+	// ProvisionedRepositories are the keys of the repositories managed in Artifactory
+	ProvisionedRepositories []string `json:"provisionedRepositories,omitempty"`
+	// LastRotated is when the credentials in the docker config secret were last generated
+	LastRotated *metav1.Time `json:"lastRotated,omitempty"`
+	// RotationRequest is the last value of the rotate-credentials annotation which was handled
+	RotationRequest string `json:"rotationRequest,omitempty"`
+	// TokenExpiry is when the access token in the docker config secret expires, unset for user credentials
+	TokenExpiry *metav1.Time `json:"tokenExpiry,omitempty"`
+	// Conditions represent the latest available observations of the Repository state
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// ConditionType is the type of a Repository condition
+type ConditionType string
+
+const (
+	// ConditionReady indicates that every Artifactory and cluster object of the Repository is in place
+	ConditionReady ConditionType = "Ready"
+	// ConditionRepositoriesProvisioned indicates that the local and virtual repositories exist in Artifactory
+	ConditionRepositoriesProvisioned ConditionType = "RepositoriesProvisioned"
+	// ConditionPermissionsSynced indicates that the permission target matches the users in the spec
+	ConditionPermissionsSynced ConditionType = "PermissionsSynced"
+	// ConditionCredentialsProvisioned indicates that the internal user or access token and docker secret are in place
+	ConditionCredentialsProvisioned ConditionType = "CredentialsProvisioned"
+	// ConditionConflict indicates that the repositories already existed and are not managed by this object
+	ConditionConflict ConditionType = "Conflict"
+	// ConditionDrifted indicates that the live Artifactory configuration differs from the desired configuration
+	ConditionDrifted ConditionType = "Drifted"
+	// ConditionRepotypeMigrated indicates that the repositories were moved to a changed repotype
+	ConditionRepotypeMigrated ConditionType = "RepotypeMigrated"
+	// ConditionBackendConfigured indicates that the operator has a valid url and credentials for Artifactory
+	ConditionBackendConfigured ConditionType = "BackendConfigured"
+)
+
+// Condition describes one aspect of the state of a Repository
+type Condition struct {
+	// Type of the condition
+	Type ConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown
+	Status metav1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the generation the condition was set for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime is the last time the condition changed from one status to another
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a CamelCase reason for the last transition
+	Reason string `json:"reason,omitempty"`
+	// Message is a human readable message about the last transition
+	Message string `json:"message,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:shortName=repo
+// +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Repotype",type=string,JSONPath=`.spec.repotype`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
 // Repository is the Schema for the repositories API
 type Repository struct {
 	metav1.TypeMeta   `json:",inline"`
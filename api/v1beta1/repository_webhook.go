@@ -0,0 +1,137 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// log is for logging in this package.
+var repositorylog = logf.Log.WithName("repository-resource")
+
+// SupportedRepotypes are the package types the operator knows how to lay out in Artifactory
+var SupportedRepotypes = []string{"maven", "docker", "npm", "nuget", "bower", "composer", "conan", "go", "gradle", "ivy", "puppet", "sbt"}
+
+const (
+	// maxRepositoryKeyLength is the longest repository key Artifactory accepts
+	maxRepositoryKeyLength = 64
+	// longest suffix the operator appends to the name for a repository key
+	longestMavenKeySuffix = "-snapshot-local"
+	longestKeySuffix      = "-local"
+)
+
+// Limits of the credentials, the controller applies them as well when the webhook is disabled
+const (
+	// MinRotationInterval is the shortest interval the credentials may be renewed in
+	MinRotationInterval = time.Minute
+	// MinTokenLifetime is the shortest lifetime of an access token
+	MinTokenLifetime = 10 * time.Minute
+)
+
+// Artifactory user names must be lower case
+var userNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._@+-]*$`)
+
+// SetupWebhookWithManager registers the validating webhook for Repository with the manager
+func (r *Repository) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-repository-storage-sebshift-io-v1beta1-repository,mutating=false,failurePolicy=fail,groups=repository.storage.sebshift.io,resources=repositories,versions=v1beta1,name=vrepository.kb.io
+
+var _ webhook.Validator = &Repository{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Repository) ValidateCreate() error {
+	repositorylog.Info("validate create", "name", r.Name)
+	return r.validateRepository()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Repository) ValidateUpdate(old runtime.Object) error {
+	repositorylog.Info("validate update", "name", r.Name)
+	if oldRepo, ok := old.(*Repository); ok && oldRepo.Spec.Repotype != r.Spec.Repotype && !r.allowsRepotypeMigration() {
+		return fmt.Errorf("spec.repotype can't be changed from %q to %q, the previous repositories would be deleted with every artifact; "+
+			"set spec.deletionPolicy to Retain or Archive, or annotate the Repository with %s=true",
+			oldRepo.Spec.Repotype, r.Spec.Repotype, MigrateRepotypeAnnotation)
+	}
+	// A changed repotype is migrated by the controller
+	return r.validateRepository()
+}
+
+// The controller only deletes the previous repositories on a repotype migration with the Delete policy
+func (r *Repository) allowsRepotypeMigration() bool {
+	switch r.Spec.DeletionPolicy {
+	case DeletionPolicyRetain, DeletionPolicyArchive:
+		return true
+	}
+	return r.Annotations[MigrateRepotypeAnnotation] == "true"
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Repository) ValidateDelete() error {
+	return nil
+}
+
+// Validate the spec and the Artifactory keys which will be derived from it
+func (r *Repository) validateRepository() error {
+	errs := []string{}
+	if !isSupportedRepotype(r.Spec.Repotype) {
+		errs = append(errs, fmt.Sprintf("spec.repotype %q is not supported, use one of %s", r.Spec.Repotype, strings.Join(SupportedRepotypes, ", ")))
+	}
+	for _, user := range r.Spec.Users {
+		if !userNameRegexp.MatchString(user) {
+			errs = append(errs, fmt.Sprintf("spec.users %q is not a valid Artifactory user name, names must be lower case", user))
+		}
+	}
+	suffix := longestKeySuffix
+	if r.Spec.Repotype == "maven" {
+		suffix = longestMavenKeySuffix
+	}
+	if key := r.Name + "-" + r.Spec.Repotype + suffix; len(key) > maxRepositoryKeyLength {
+		errs = append(errs, fmt.Sprintf("repository key %q is longer than %d characters, use a shorter name", key, maxRepositoryKeyLength))
+	}
+	if c := r.Spec.Credentials; c != nil && c.RotationInterval != nil {
+		if d := c.RotationInterval.Duration; d != 0 && d < MinRotationInterval {
+			errs = append(errs, fmt.Sprintf("spec.credentials.rotationInterval must be 0s or at least %v", MinRotationInterval))
+		}
+	}
+	if c := r.Spec.Credentials; c != nil && c.TokenLifetime != nil && c.TokenLifetime.Duration < MinTokenLifetime {
+		errs = append(errs, fmt.Sprintf("spec.credentials.tokenLifetime must be at least %v", MinTokenLifetime))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func isSupportedRepotype(repotype string) bool {
+	for _, t := range SupportedRepotypes {
+		if t == repotype {
+			return true
+		}
+	}
+	return false
+}
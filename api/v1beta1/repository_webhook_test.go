@@ -0,0 +1,152 @@
+package v1beta1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newRepository(name, repotype string, users ...string) *Repository {
+	return &Repository{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+		Spec:       RepositorySpec{Repotype: repotype, Users: users},
+	}
+}
+
+func TestRepository_ValidateCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		repository *Repository
+		wantErr    bool
+	}{
+		{
+			name:       "Valid maven repository",
+			repository: newRepository("test", "maven", "user1", "first.last@example.com"),
+			wantErr:    false,
+		},
+		{
+			name:       "Valid docker repository",
+			repository: newRepository("test", "docker"),
+			wantErr:    false,
+		},
+		{
+			name:       "Unsupported repotype",
+			repository: newRepository("test", "maven/docker/nuget/npm"),
+			wantErr:    true,
+		},
+		{
+			name:       "Empty repotype",
+			repository: newRepository("test", ""),
+			wantErr:    true,
+		},
+		{
+			name:       "Upper case user",
+			repository: newRepository("test", "npm", "User1"),
+			wantErr:    true,
+		},
+		{
+			name:       "Maven key too long",
+			repository: newRepository(strings.Repeat("a", 45), "maven"),
+			wantErr:    true,
+		},
+		{
+			name:       "Npm key at the limit",
+			repository: newRepository(strings.Repeat("a", 54), "npm"),
+			wantErr:    false,
+		},
+		{
+			name:       "Daily credential rotation",
+			repository: withRotationInterval(newRepository("test", "docker"), 24*time.Hour),
+			wantErr:    false,
+		},
+		{
+			name:       "Credential rotation too often",
+			repository: withRotationInterval(newRepository("test", "docker"), time.Second),
+			wantErr:    true,
+		},
+		{
+			name:       "Access token lifetime too short",
+			repository: withTokenLifetime(newRepository("test", "docker"), time.Minute),
+			wantErr:    true,
+		},
+		{
+			name:       "Daily access tokens",
+			repository: withTokenLifetime(newRepository("test", "docker"), 24*time.Hour),
+			wantErr:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.repository.ValidateCreate(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCreate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRepository_ValidateUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		old     *Repository
+		new     *Repository
+		wantErr bool
+	}{
+		{
+			name:    "Users changed",
+			old:     newRepository("test", "maven", "user1"),
+			new:     newRepository("test", "maven", "user1", "user2"),
+			wantErr: false,
+		},
+		{
+			name:    "Repotype changed",
+			old:     newRepository("test", "maven"),
+			new:     newRepository("test", "docker"),
+			wantErr: true,
+		},
+		{
+			name: "Repotype changed with the Retain policy",
+			old:  newRepository("test", "maven"),
+			new: func() *Repository {
+				r := newRepository("test", "docker")
+				r.Spec.DeletionPolicy = DeletionPolicyRetain
+				return r
+			}(),
+			wantErr: false,
+		},
+		{
+			name: "Repotype changed with the migrate annotation",
+			old:  newRepository("test", "maven"),
+			new: func() *Repository {
+				r := newRepository("test", "docker")
+				r.Annotations = map[string]string{MigrateRepotypeAnnotation: "true"}
+				return r
+			}(),
+			wantErr: false,
+		},
+		{
+			name:    "Invalid user added",
+			old:     newRepository("test", "maven", "user1"),
+			new:     newRepository("test", "maven", "user1", "User2"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.new.ValidateUpdate(tt.old); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateUpdate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func withRotationInterval(r *Repository, interval time.Duration) *Repository {
+	r.Spec.Credentials = &CredentialsSpec{RotationInterval: &metav1.Duration{Duration: interval}}
+	return r
+}
+
+func withTokenLifetime(r *Repository, lifetime time.Duration) *Repository {
+	r.Spec.Credentials = &CredentialsSpec{Type: CredentialsTypeAccessToken, TokenLifetime: &metav1.Duration{Duration: lifetime}}
+	return r
+}
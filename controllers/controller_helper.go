@@ -4,16 +4,31 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	"github.com/sebgroup/repo-operator/pkg/repository"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"os"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"strconv"
+	"strings"
 )
 
-// It returns a dockerconfig secret for service account.
-func (r *RepositoryReconciler) generateRepoSecret(namespace string, secretName string, u string, p string) *v1.Secret {
+const (
+	// DefaultSecretName is the template for the name of the docker config secret of a docker repository
+	DefaultSecretName = repository.NamePlaceholder + "-repo-docker-secret"
+	// DefaultImagePullServiceAccount gets the docker config secret as image pull secret
+	DefaultImagePullServiceAccount = "default"
+	// DefaultBuilderServiceAccount gets the docker config secret to push images
+	DefaultBuilderServiceAccount = "builder"
+)
+
+// It returns a dockerconfig secret for service account, with the credentials for every registry.
+func (r *RepositoryReconciler) generateRepoSecret(namespace string, secretName string, u string, p string, registries []string) *v1.Secret {
 	labels := map[string]string{
 		"origin": "repo-operator",
 		"type":   "dockercfg",
@@ -30,20 +45,23 @@ func (r *RepositoryReconciler) generateRepoSecret(namespace string, secretName s
 	s.Type = v1.SecretTypeDockerConfigJson
 	s.Data = map[string][]byte{}
 
-	dockercfgJSONContent, _ := handleDockerCfgJSONContent(u, p, "unused", secretName)
+	dockercfgJSONContent, _ := handleDockerCfgJSONContent(u, p, "unused", registries)
 	s.Data[v1.DockerConfigJsonKey] = dockercfgJSONContent
 	return s
 }
 
 //Generate Docker config secret content
-func handleDockerCfgJSONContent(username, password, email, server string) ([]byte, error) {
+func handleDockerCfgJSONContent(username, password, email string, servers []string) ([]byte, error) {
 	dockercfgAuth := DockerConfigEntry{
 		Email: email,
 		Auth:  encodeDockerConfigFieldAuth(username, password),
 	}
 
 	dockerCfgJSON := DockerConfigJSON{
-		Auths: map[string]DockerConfigEntry{server: dockercfgAuth},
+		Auths: map[string]DockerConfigEntry{},
+	}
+	for _, server := range servers {
+		dockerCfgJSON.Auths[server] = dockercfgAuth
 	}
 
 	return json.Marshal(dockerCfgJSON)
@@ -94,10 +112,10 @@ func linkSecret(sa *v1.ServiceAccount, secret string) bool {
 }
 
 // UnLink the secret from builder SA
-func unLinkBuilderSASecret(builderSA *v1.ServiceAccount, reqName string) *v1.ServiceAccount {
+func unLinkBuilderSASecret(builderSA *v1.ServiceAccount, secret string) *v1.ServiceAccount {
 	secrets := []v1.ObjectReference{}
 	for _, s := range builderSA.Secrets {
-		if s.Name != reqName+suffixSecretName {
+		if s.Name != secret {
 			secrets = append(secrets, s)
 		}
 	}
@@ -106,10 +124,10 @@ func unLinkBuilderSASecret(builderSA *v1.ServiceAccount, reqName string) *v1.Ser
 }
 
 // Unlink the pull secret from default SA
-func unLinkDefaultSAPullSecret(defaultSA *v1.ServiceAccount, reqName string) *v1.ServiceAccount {
+func unLinkDefaultSAPullSecret(defaultSA *v1.ServiceAccount, secret string) *v1.ServiceAccount {
 	secrets := []v1.LocalObjectReference{}
 	for _, s := range defaultSA.ImagePullSecrets {
-		if s.Name != reqName+suffixSecretName {
+		if s.Name != secret {
 			secrets = append(secrets, v1.LocalObjectReference{
 				Name: s.Name,
 			})
@@ -119,6 +137,152 @@ func unLinkDefaultSAPullSecret(defaultSA *v1.ServiceAccount, reqName string) *v1
 	return defaultSA
 }
 
+// Whether the Artifactory requests for the repository are logged, the annotation of the repository takes
+// precedence over its namespace
+func (r *RepositoryReconciler) debugEnabled(instance *repositoryv1beta1.Repository) bool {
+	if debug, err := strconv.ParseBool(instance.Annotations[repositoryv1beta1.DebugAnnotation]); err == nil {
+		return debug
+	}
+	for _, namespace := range r.DebugNamespaces {
+		if namespace == instance.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Set a condition on the repository status, the transition time is only moved when the condition status changes
+func setCondition(instance *repositoryv1beta1.Repository, conditionType repositoryv1beta1.ConditionType, status metav1.ConditionStatus, reason string, message string) {
+	condition := repositoryv1beta1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: instance.Generation,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+	for i, c := range instance.Status.Conditions {
+		if c.Type == conditionType {
+			if c.Status == status {
+				condition.LastTransitionTime = c.LastTransitionTime
+			}
+			instance.Status.Conditions[i] = condition
+			return
+		}
+	}
+	instance.Status.Conditions = append(instance.Status.Conditions, condition)
+}
+
+// Find a condition by type in the repository status
+func findCondition(instance *repositoryv1beta1.Repository, conditionType repositoryv1beta1.ConditionType) *repositoryv1beta1.Condition {
+	for i := range instance.Status.Conditions {
+		if instance.Status.Conditions[i].Type == conditionType {
+			return &instance.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// Mark the failed step and the Ready condition as false and pass the error on
+func setFailedCondition(instance *repositoryv1beta1.Repository, conditionType repositoryv1beta1.ConditionType, reason string, err error) error {
+	setCondition(instance, conditionType, metav1.ConditionFalse, reason, err.Error())
+	setCondition(instance, repositoryv1beta1.ConditionReady, metav1.ConditionFalse, reason, err.Error())
+	return err
+}
+
+// Mark the repositories as not provisioned. A rejected adoption is not retried, the repositories
+// stay in conflict until the spec changes.
+func setProvisioningFailedCondition(instance *repositoryv1beta1.Repository, err error) error {
+	if _, ok := err.(*repository.AdoptionError); ok {
+		instance.Status.Statuscode = conflictStateCode
+		instance.Status.State = conflictState
+		setCondition(instance, repositoryv1beta1.ConditionRepositoriesProvisioned, metav1.ConditionFalse, reasonAdoptionRejected, err.Error())
+		setCondition(instance, repositoryv1beta1.ConditionConflict, metav1.ConditionTrue, reasonAdoptionRejected, err.Error())
+		return nil
+	}
+	return setFailedCondition(instance, repositoryv1beta1.ConditionRepositoriesProvisioned, reasonProvisioningFailed, err)
+}
+
+// Set the RepositoriesProvisioned and Conflict conditions from the state returned by Artifactory
+func setProvisionedConditions(instance *repositoryv1beta1.Repository) {
+	setCondition(instance, repositoryv1beta1.ConditionRepositoriesProvisioned, metav1.ConditionTrue, reasonProvisioned, "")
+	if instance.Status.State == conflictState {
+		setCondition(instance, repositoryv1beta1.ConditionConflict, metav1.ConditionTrue, reasonAlreadyExists, messageConflict)
+	} else {
+		setCondition(instance, repositoryv1beta1.ConditionConflict, metav1.ConditionFalse, reasonManaged, "")
+	}
+}
+
+// Set the Ready condition once every step of the reconcile succeeded
+func setReadyCondition(instance *repositoryv1beta1.Repository) {
+	if instance.Status.State == conflictState {
+		reason, message := reasonConflict, messageConflict
+		if c := findCondition(instance, repositoryv1beta1.ConditionConflict); c != nil && c.Status == metav1.ConditionTrue {
+			reason, message = c.Reason, c.Message
+		}
+		setCondition(instance, repositoryv1beta1.ConditionReady, metav1.ConditionFalse, reason, message)
+		return
+	}
+	setCondition(instance, repositoryv1beta1.ConditionReady, metav1.ConditionTrue, reasonReconciled, "")
+}
+
+// Reason of a failed reconcile, taken from the Ready condition when it reports the failure
+func failureReason(instance *repositoryv1beta1.Repository) string {
+	if c := findCondition(instance, repositoryv1beta1.ConditionReady); c != nil && c.Status == metav1.ConditionFalse {
+		return c.Reason
+	}
+	return reasonReconcileFailed
+}
+
+// repositoryEventRecorder records the events of the repository client on a repository
+type repositoryEventRecorder struct {
+	recorder record.EventRecorder
+	instance *repositoryv1beta1.Repository
+}
+
+// Eventf implements repository.EventRecorder
+func (e *repositoryEventRecorder) Eventf(eventtype, reason, messageFmt string, args ...interface{}) {
+	e.recorder.Eventf(e.instance, eventtype, reason, messageFmt, args...)
+}
+
+// Names of the virtual repositories created for a request, the local repositories carry an additional suffix
+func repositoryNames(reqName string, repoType string) []string {
+	if repoType == mavenRepoType {
+		return []string{reqName + "-" + repoType + snapshotSuffix, reqName + "-" + repoType + releaseSuffix}
+	}
+	return []string{reqName + "-" + repoType}
+}
+
+// Keys of the local and virtual repositories created for a request
+func repositoryKeys(reqName string, repoType string) []string {
+	keys := []string{}
+	for _, name := range repositoryNames(reqName, repoType) {
+		keys = append(keys, name+suffixPackageClassLocal, name)
+	}
+	return keys
+}
+
+// Status code passed on when creating the repositories. Repositories which are tracked as provisioned are
+// the operator's own, repositories of a new repotype are not provisioned yet and finding them in Artifactory
+// is a conflict. The status code of the last reconcile is only used for a status without tracked repositories.
+func provisionedStatusCode(instance *repositoryv1beta1.Repository, reqName string) int {
+	tracked := true
+	for _, key := range repositoryKeys(reqName, instance.Spec.Repotype) {
+		if !containsString(instance.Status.ProvisionedRepositories, key) {
+			tracked = false
+			break
+		}
+	}
+	if tracked {
+		return okStateCode
+	}
+	previousType := instance.Status.ProvisionedRepotype
+	if previousType == "" || previousType == instance.Spec.Repotype {
+		return instance.Status.Statuscode
+	}
+	return 0
+}
+
 // Helper functions to check and remove string from a slice of strings.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
@@ -139,10 +303,11 @@ func removeString(slice []string, s string) (result []string) {
 	return
 }
 
-// newOwnerRef creates an OwnerReference pointing to the given owner.
+// newOwnerRef creates an OwnerReference pointing to the given owner as the controller of the object, so the
+// controller is notified of changes to the object.
 func newOwnerRef(owner metav1.Object, gvk schema.GroupVersionKind) *metav1.OwnerReference {
 	blockOwnerDeletion := false
-	isController := false
+	isController := true
 	return &metav1.OwnerReference{
 		APIVersion:         gvk.GroupVersion().String(),
 		Kind:               gvk.Kind,
@@ -199,3 +364,58 @@ func referSameObject(a, b metav1.OwnerReference) bool {
 
 	return aGV == bGV && a.Kind == b.Kind && a.Name == b.Name
 }
+
+// URL of Artifactory, reported in the status of the repositories. The url of the current client is loaded
+// from the credentials secret, the client config only has it when it's set in the config file or environment.
+func (r *RepositoryReconciler) backendURL() string {
+	if r.backend != nil {
+		if url := r.backend.BaseURL(); url != "" {
+			return url
+		}
+	}
+	if r.ClientConfig == nil {
+		return os.Getenv("REPOSITORY_URL")
+	}
+	return r.ClientConfig.BaseURL
+}
+
+// Name of the Artifactory user of a docker repository
+func (r *RepositoryReconciler) userName(reqName string) string {
+	if r.ClientConfig == nil {
+		return repository.DefaultNaming.UserName(reqName)
+	}
+	return r.ClientConfig.Naming.UserName(reqName)
+}
+
+// Name of the group the access tokens of a docker repository are scoped to
+func (r *RepositoryReconciler) groupName(reqName string) string {
+	if r.ClientConfig == nil {
+		return repository.DefaultNaming.GroupName(reqName)
+	}
+	return r.ClientConfig.Naming.GroupName(reqName)
+}
+
+// Name of the docker config secret of a docker repository
+func (r *RepositoryReconciler) secretName(reqName string) string {
+	template := r.SecretName
+	if template == "" {
+		template = DefaultSecretName
+	}
+	return strings.Replace(template, repository.NamePlaceholder, reqName, -1)
+}
+
+// Service account which gets the docker config secret as image pull secret
+func (r *RepositoryReconciler) imagePullServiceAccount() string {
+	if r.ImagePullServiceAccount == "" {
+		return DefaultImagePullServiceAccount
+	}
+	return r.ImagePullServiceAccount
+}
+
+// Service account which gets the docker config secret to push images
+func (r *RepositoryReconciler) builderServiceAccount() string {
+	if r.BuilderServiceAccount == "" {
+		return DefaultBuilderServiceAccount
+	}
+	return r.BuilderServiceAccount
+}
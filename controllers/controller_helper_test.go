@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"errors"
 	"github.com/go-logr/logr"
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	"github.com/sebgroup/repo-operator/pkg/repository"
 	v1 "k8s.io/api/core/v1"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -9,6 +12,7 @@ import (
 	"sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"testing"
+	"time"
 )
 
 func TestRepositoryReconciler_generateRepoSecret(t *testing.T) {
@@ -50,7 +54,7 @@ func TestRepositoryReconciler_generateRepoSecret(t *testing.T) {
 				Scheme: tt.fields.Scheme,
 				rtc:    tt.fields.rtc,
 			}
-			if got := r.generateRepoSecret(tt.args.n, tt.args.req, tt.args.u, tt.args.p); !reflect.DeepEqual(got.Name, tt.want.Name) {
+			if got := r.generateRepoSecret(tt.args.n, tt.args.req, tt.args.u, tt.args.p, []string{"artifactory"}); !reflect.DeepEqual(got.Name, tt.want.Name) {
 				t.Errorf("generateRepoSecret() = %v, want %v", got, tt.want)
 			}
 		})
@@ -180,7 +184,7 @@ func Test_linkSecret(t *testing.T) {
 func Test_unLinkBuilderSASecret(t *testing.T) {
 	type args struct {
 		builderSA *v1.ServiceAccount
-		reqName   string
+		secret    string
 	}
 	tests := []struct {
 		name string
@@ -208,7 +212,7 @@ func Test_unLinkBuilderSASecret(t *testing.T) {
 					},
 					ImagePullSecrets: nil,
 				},
-				reqName: "test",
+				secret: "test-repo-docker-secret",
 			},
 			want: &v1.ServiceAccount{
 				TypeMeta: v12.TypeMeta{},
@@ -229,7 +233,7 @@ func Test_unLinkBuilderSASecret(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := unLinkBuilderSASecret(tt.args.builderSA, tt.args.reqName)
+			got := unLinkBuilderSASecret(tt.args.builderSA, tt.args.secret)
 			for _, s := range got.Secrets {
 				if s.Name == "test-repo-docker-secret" {
 					t.Errorf("unLinkBuilderSASecret() = %v, want %v", got, tt.want)
@@ -242,7 +246,7 @@ func Test_unLinkBuilderSASecret(t *testing.T) {
 func Test_unLinkDefaultSAPullSecret(t *testing.T) {
 	type args struct {
 		defaultSA *v1.ServiceAccount
-		reqName   string
+		secret    string
 	}
 	tests := []struct {
 		name string
@@ -270,7 +274,7 @@ func Test_unLinkDefaultSAPullSecret(t *testing.T) {
 						},
 					},
 				},
-				reqName: "test",
+				secret: "test-repo-docker-secret",
 			},
 			want: &v1.ServiceAccount{
 				TypeMeta: v12.TypeMeta{},
@@ -291,7 +295,7 @@ func Test_unLinkDefaultSAPullSecret(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := unLinkDefaultSAPullSecret(tt.args.defaultSA, tt.args.reqName)
+			got := unLinkDefaultSAPullSecret(tt.args.defaultSA, tt.args.secret)
 			for _, s := range got.ImagePullSecrets {
 				if s.Name == "test-repo-docker-secret" {
 					t.Errorf("unLinkDefaultSAPullSecret() = %v, want %v", got, tt.want)
@@ -375,3 +379,147 @@ func Test_removeString(t *testing.T) {
 		})
 	}
 }
+
+func Test_setCondition(t *testing.T) {
+	transitionTime := v12.NewTime(time.Now().Add(-time.Hour))
+	type args struct {
+		instance      *repositoryv1beta1.Repository
+		conditionType repositoryv1beta1.ConditionType
+		status        v12.ConditionStatus
+		reason        string
+	}
+	tests := []struct {
+		name           string
+		args           args
+		wantConditions int
+		keepTransition bool
+	}{
+		{
+			name: "Add a new condition",
+			args: args{
+				instance:      &repositoryv1beta1.Repository{},
+				conditionType: repositoryv1beta1.ConditionReady,
+				status:        v12.ConditionTrue,
+				reason:        reasonReconciled,
+			},
+			wantConditions: 1,
+			keepTransition: false,
+		},
+		{
+			name: "Update condition without status change keeps the transition time",
+			args: args{
+				instance: &repositoryv1beta1.Repository{
+					Status: repositoryv1beta1.RepositoryStatus{
+						Conditions: []repositoryv1beta1.Condition{
+							{Type: repositoryv1beta1.ConditionReady, Status: v12.ConditionTrue, LastTransitionTime: transitionTime},
+						},
+					},
+				},
+				conditionType: repositoryv1beta1.ConditionReady,
+				status:        v12.ConditionTrue,
+				reason:        reasonReconciled,
+			},
+			wantConditions: 1,
+			keepTransition: true,
+		},
+		{
+			name: "Update condition with status change moves the transition time",
+			args: args{
+				instance: &repositoryv1beta1.Repository{
+					Status: repositoryv1beta1.RepositoryStatus{
+						Conditions: []repositoryv1beta1.Condition{
+							{Type: repositoryv1beta1.ConditionReady, Status: v12.ConditionTrue, LastTransitionTime: transitionTime},
+							{Type: repositoryv1beta1.ConditionConflict, Status: v12.ConditionFalse, LastTransitionTime: transitionTime},
+						},
+					},
+				},
+				conditionType: repositoryv1beta1.ConditionReady,
+				status:        v12.ConditionFalse,
+				reason:        reasonConflict,
+			},
+			wantConditions: 2,
+			keepTransition: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setCondition(tt.args.instance, tt.args.conditionType, tt.args.status, tt.args.reason, "")
+			if got := len(tt.args.instance.Status.Conditions); got != tt.wantConditions {
+				t.Errorf("setCondition() conditions = %v, want %v", got, tt.wantConditions)
+			}
+			c := findCondition(tt.args.instance, tt.args.conditionType)
+			if c == nil {
+				t.Fatalf("setCondition() condition %v not found", tt.args.conditionType)
+			}
+			if c.Status != tt.args.status || c.Reason != tt.args.reason {
+				t.Errorf("setCondition() = %v, want status %v reason %v", c, tt.args.status, tt.args.reason)
+			}
+			if c.LastTransitionTime.Equal(&transitionTime) != tt.keepTransition {
+				t.Errorf("setCondition() transition time = %v, keep %v", c.LastTransitionTime, tt.keepTransition)
+			}
+		})
+	}
+}
+
+func Test_setFailedCondition(t *testing.T) {
+	instance := &repositoryv1beta1.Repository{}
+	err := setFailedCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, reasonPermissionsSyncFailed, errors.New("artifactory unavailable"))
+	if err == nil || err.Error() != "artifactory unavailable" {
+		t.Errorf("setFailedCondition() error = %v", err)
+	}
+	for _, conditionType := range []repositoryv1beta1.ConditionType{repositoryv1beta1.ConditionPermissionsSynced, repositoryv1beta1.ConditionReady} {
+		c := findCondition(instance, conditionType)
+		if c == nil || c.Status != v12.ConditionFalse || c.Reason != reasonPermissionsSyncFailed {
+			t.Errorf("setFailedCondition() condition %v = %v", conditionType, c)
+		}
+	}
+}
+
+func TestRepositoryReconciler_names(t *testing.T) {
+	r := &RepositoryReconciler{}
+	if got := r.secretName("test"); got != "test-repo-docker-secret" {
+		t.Errorf("secretName() = %v, want the default name", got)
+	}
+	if r.imagePullServiceAccount() != "default" || r.builderServiceAccount() != "builder" {
+		t.Errorf("service accounts = %v, %v, want default and builder", r.imagePullServiceAccount(), r.builderServiceAccount())
+	}
+	r = &RepositoryReconciler{
+		ClientConfig:            &repository.ClientConfig{BaseURL: "https://artifactory", Naming: repository.Naming{User: "svc-{name}"}},
+		SecretName:              "pull-{name}",
+		ImagePullServiceAccount: "deployer",
+		BuilderServiceAccount:   "pipeline",
+	}
+	if got := r.secretName("test"); got != "pull-test" {
+		t.Errorf("secretName() = %v, want pull-test", got)
+	}
+	if got := r.userName("test"); got != "svc-test" {
+		t.Errorf("userName() = %v, want svc-test", got)
+	}
+	if r.imagePullServiceAccount() != "deployer" || r.builderServiceAccount() != "pipeline" || r.backendURL() != "https://artifactory" {
+		t.Errorf("names = %v, %v, %v", r.imagePullServiceAccount(), r.builderServiceAccount(), r.backendURL())
+	}
+}
+
+func TestRepositoryReconciler_debugEnabled(t *testing.T) {
+	r := &RepositoryReconciler{DebugNamespaces: []string{"tenant-a"}}
+	tests := []struct {
+		name        string
+		namespace   string
+		annotations map[string]string
+		want        bool
+	}{
+		{name: "Test a debug namespace", namespace: "tenant-a", want: true},
+		{name: "Test another namespace", namespace: "tenant-b", want: false},
+		{name: "Test the annotation enables a repository", namespace: "tenant-b", annotations: map[string]string{repositoryv1beta1.DebugAnnotation: "true"}, want: true},
+		{name: "Test the annotation disables a repository in a debug namespace", namespace: "tenant-a", annotations: map[string]string{repositoryv1beta1.DebugAnnotation: "false"}, want: false},
+		{name: "Test an invalid annotation is ignored", namespace: "tenant-b", annotations: map[string]string{repositoryv1beta1.DebugAnnotation: "yes please"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := &repositoryv1beta1.Repository{ObjectMeta: v12.ObjectMeta{Namespace: tt.namespace, Name: "repo", Annotations: tt.annotations}}
+			if got := r.debugEnabled(instance); got != tt.want {
+				t.Errorf("debugEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
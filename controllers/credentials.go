@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/sebgroup/repo-operator/pkg/repository"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Keys of the credentials secret
+const (
+	CredentialsURLKey      = "url"
+	CredentialsUsernameKey = "username"
+	CredentialsPasswordKey = "password"
+	CredentialsTokenKey    = "token"
+	CredentialsAccessKey   = "access-token"
+	CredentialsRefreshKey  = "refresh-token"
+	CredentialsCAKey       = "ca.crt"
+	CredentialsCertKey     = "tls.crt"
+	CredentialsKeyKey      = "tls.key"
+	CredentialsProxyKey    = "proxy-url"
+	CredentialsVerifyKey   = "verify-ssl"
+)
+
+// Delay before a Repository is reconciled again while the Artifactory backend is not configured
+const backendNotConfiguredDelay = 30 * time.Second
+
+// credentialsWatcher configures the Artifactory backend from the credentials secret every time the secret changes
+type credentialsWatcher struct {
+	key     types.NamespacedName
+	base    *repository.ClientConfig
+	backend *repository.Backend
+	// client writes refreshed access tokens back to the secret, they aren't saved when it's nil
+	client client.Client
+	log    logr.Logger
+}
+
+var _ toolscache.ResourceEventHandler = &credentialsWatcher{}
+
+// OnAdd loads the secret when it's created or first listed
+func (w *credentialsWatcher) OnAdd(obj interface{}) {
+	w.load(obj)
+}
+
+// OnUpdate loads the secret when it's changed. A resync of an unchanged secret is skipped, so that a refreshed
+// access token which couldn't be saved isn't replaced with the one in the secret.
+func (w *credentialsWatcher) OnUpdate(oldObj, newObj interface{}) {
+	if o, ok := oldObj.(*corev1.Secret); ok {
+		if n, ok := newObj.(*corev1.Secret); ok && o.ResourceVersion != "" && o.ResourceVersion == n.ResourceVersion {
+			return
+		}
+	}
+	w.load(newObj)
+}
+
+// OnDelete keeps the current client, the Repositories aren't failed because the secret is replaced
+func (w *credentialsWatcher) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if secret, ok := obj.(*corev1.Secret); ok && w.matches(secret) {
+		w.log.Info("Credentials secret was deleted, keeping the current Artifactory client", "secret", w.key.String())
+	}
+}
+
+func (w *credentialsWatcher) matches(secret *corev1.Secret) bool {
+	return secret.Namespace == w.key.Namespace && secret.Name == w.key.Name
+}
+
+func (w *credentialsWatcher) load(obj interface{}) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || !w.matches(secret) {
+		return
+	}
+	conf := clientConfigFromSecret(w.base, secret)
+	if len(secret.Data[CredentialsAccessKey]) > 0 {
+		// Artifactory may revoke the previous tokens on a refresh, a restart has to load the new ones
+		conf.TokensRefreshed = w.saveTokens
+	}
+	if err := w.backend.Configure(conf); err != nil {
+		w.log.Error(err, "Invalid credentials secret, the Artifactory backend is not configured", "secret", w.key.String())
+		return
+	}
+	w.log.Info("Loaded the Artifactory credentials", "secret", w.key.String(), "resourceVersion", secret.ResourceVersion)
+}
+
+// Write a refreshed access token and its refresh token to the credentials secret
+func (w *credentialsWatcher) saveTokens(accessToken string, refreshToken string) {
+	if w.client == nil {
+		return
+	}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		if err := w.client.Get(context.TODO(), w.key, secret); err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[CredentialsAccessKey] = []byte(accessToken)
+		if refreshToken != "" {
+			secret.Data[CredentialsRefreshKey] = []byte(refreshToken)
+		}
+		return w.client.Update(context.TODO(), secret)
+	})
+	if err != nil {
+		w.log.Error(err, "Failed to save the refreshed access token, a restart loads the previous one", "secret", w.key.String())
+		return
+	}
+	w.log.Info("Saved the refreshed access token", "secret", w.key.String())
+}
+
+// Copy the base config and replace the url, credentials, certificates and proxy with the ones in the secret.
+// An access token takes precedence over an API key, which takes precedence over the username and password.
+func clientConfigFromSecret(base *repository.ClientConfig, secret *corev1.Secret) *repository.ClientConfig {
+	conf := *base
+	// Every config gets its own connections, the previous client finishes its requests on the old ones
+	conf.Client, conf.Transport = nil, nil
+	if url := string(secret.Data[CredentialsURLKey]); url != "" {
+		conf.BaseURL = url
+	}
+	if ca := secret.Data[CredentialsCAKey]; len(ca) > 0 {
+		conf.CACert = ca
+	}
+	if verify := string(secret.Data[CredentialsVerifyKey]); verify != "" {
+		// Only an explicit false turns the verification off, a value which isn't a boolean keeps it on
+		v, err := strconv.ParseBool(verify)
+		conf.VerifySSL = v || err != nil
+	}
+	if cert, key := secret.Data[CredentialsCertKey], secret.Data[CredentialsKeyKey]; len(cert) > 0 || len(key) > 0 {
+		conf.ClientCert, conf.ClientKey = cert, key
+	}
+	if proxyURL := string(secret.Data[CredentialsProxyKey]); proxyURL != "" {
+		conf.ProxyURL = proxyURL
+	}
+	if token := string(secret.Data[CredentialsAccessKey]); token != "" {
+		conf.AuthMethod, conf.Token, conf.RefreshToken = repository.AuthMethodBearer, token, string(secret.Data[CredentialsRefreshKey])
+		conf.Username, conf.Password = "", ""
+	} else if token := string(secret.Data[CredentialsTokenKey]); token != "" {
+		conf.AuthMethod, conf.Token, conf.RefreshToken, conf.Username, conf.Password = repository.AuthMethodToken, token, "", "", ""
+	} else if username := string(secret.Data[CredentialsUsernameKey]); username != "" {
+		conf.AuthMethod, conf.Username, conf.Password = repository.AuthMethodBasic, username, string(secret.Data[CredentialsPasswordKey])
+		conf.Token, conf.RefreshToken = "", ""
+	}
+	return &conf
+}
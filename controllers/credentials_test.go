@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	"github.com/sebgroup/repo-operator/pkg/repository"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func credentialsSecret(data map[string]string) *corev1.Secret {
+	s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "repo-operator", Name: "repo-operator-repo-secret"}, Data: map[string][]byte{}}
+	for k, v := range data {
+		s.Data[k] = []byte(v)
+	}
+	return s
+}
+
+func Test_clientConfigFromSecret(t *testing.T) {
+	base := &repository.ClientConfig{BaseURL: "https://base", AuthMethod: "basic", Username: "env", Password: "env", MaxRetries: 3}
+	tests := []struct {
+		name string
+		data map[string]string
+		want repository.ClientConfig
+	}{
+		{
+			name: "Test username and password replace the base credentials",
+			data: map[string]string{"url": "https://artifactory", "username": "admin", "password": "secret"},
+			want: repository.ClientConfig{BaseURL: "https://artifactory", AuthMethod: "basic", Username: "admin", Password: "secret", MaxRetries: 3},
+		},
+		{
+			name: "Test a token takes precedence over the username",
+			data: map[string]string{"username": "admin", "password": "secret", "token": "api-key"},
+			want: repository.ClientConfig{BaseURL: "https://base", AuthMethod: "token", Token: "api-key", MaxRetries: 3},
+		},
+		{
+			name: "Test an access token takes precedence over the API key",
+			data: map[string]string{"token": "api-key", "access-token": "eyJ.access.token", "refresh-token": "refresh"},
+			want: repository.ClientConfig{BaseURL: "https://base", AuthMethod: "bearer", Token: "eyJ.access.token", RefreshToken: "refresh", MaxRetries: 3},
+		},
+		{
+			name: "Test the certificate verification is turned on",
+			data: map[string]string{"verify-ssl": "true"},
+			want: repository.ClientConfig{BaseURL: "https://base", AuthMethod: "basic", Username: "env", Password: "env", MaxRetries: 3, VerifySSL: true},
+		},
+		{
+			name: "Test a verify-ssl which isn't a boolean keeps the verification on",
+			data: map[string]string{"verify-ssl": "yes"},
+			want: repository.ClientConfig{BaseURL: "https://base", AuthMethod: "basic", Username: "env", Password: "env", MaxRetries: 3, VerifySSL: true},
+		},
+		{
+			name: "Test an empty secret keeps the base config",
+			data: map[string]string{},
+			want: repository.ClientConfig{BaseURL: "https://base", AuthMethod: "basic", Username: "env", Password: "env", MaxRetries: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clientConfigFromSecret(base, credentialsSecret(tt.data))
+			if got.BaseURL != tt.want.BaseURL || got.AuthMethod != tt.want.AuthMethod || got.Username != tt.want.Username ||
+				got.Password != tt.want.Password || got.Token != tt.want.Token || got.RefreshToken != tt.want.RefreshToken ||
+				got.MaxRetries != tt.want.MaxRetries || got.VerifySSL != tt.want.VerifySSL {
+				t.Errorf("clientConfigFromSecret() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if base.Username != "env" {
+		t.Errorf("base config = %+v, want it unchanged", base)
+	}
+}
+
+func Test_credentialsWatcher(t *testing.T) {
+	backend := repository.NewBackend()
+	w := &credentialsWatcher{
+		key:     types.NamespacedName{Namespace: "repo-operator", Name: "repo-operator-repo-secret"},
+		base:    repository.DefaultClientConfig(),
+		backend: backend,
+		log:     ctrl.Log.WithName("test"),
+	}
+	other := credentialsSecret(map[string]string{"url": "https://artifactory", "token": "api-key"})
+	other.Name = "other"
+	w.OnAdd(other)
+	if err := backend.Configured(); !errors.Is(err, repository.ErrBackendNotConfigured) {
+		t.Errorf("Configured() = %v, want another secret to be ignored", err)
+	}
+
+	valid := credentialsSecret(map[string]string{"url": "https://artifactory", "token": "api-key"})
+	w.OnAdd(valid)
+	if err := backend.Configured(); err != nil {
+		t.Errorf("Configured() = %v, want nil after a valid secret", err)
+	}
+	w.OnDelete(toolscache.DeletedFinalStateUnknown{Obj: valid})
+	if err := backend.Configured(); err != nil {
+		t.Errorf("Configured() = %v, want the client kept after the secret was deleted", err)
+	}
+	w.OnUpdate(valid, credentialsSecret(map[string]string{"url": "https://artifactory", "username": "admin"}))
+	if err := backend.Configured(); !errors.Is(err, repository.ErrBackendNotConfigured) {
+		t.Errorf("Configured() = %v, want ErrBackendNotConfigured after an invalid secret", err)
+	}
+}
+
+func Test_CredentialsSecretURL(t *testing.T) {
+	// The url is only in the credentials secret, like in the operator deployment
+	base := repository.DefaultClientConfig()
+	backend := repository.NewBackend()
+	w := &credentialsWatcher{
+		key:     types.NamespacedName{Namespace: "repo-operator", Name: "repo-operator-repo-secret"},
+		base:    base,
+		backend: backend,
+		log:     ctrl.Log.WithName("test"),
+	}
+	w.OnAdd(credentialsSecret(map[string]string{"url": "https://artifactory.example.com/artifactory", "token": "api-key"}))
+
+	repo := &repositoryv1beta1.Repository{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "repository.storage.sebshift.io/v1beta1", Kind: "Repository"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-repository", Namespace: "test-namespace", Finalizers: []string{finalizer}},
+		Spec:       repositoryv1beta1.RepositorySpec{Repotype: "docker"},
+	}
+	saDefault := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test-namespace"}}
+	saBuilder := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "test-namespace"}}
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repo)
+	cl := fake.NewFakeClientWithScheme(s, repo, saDefault, saBuilder)
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, Recorder: record.NewFakeRecorder(10),
+		ClientConfig: base, backend: backend, rtc: &mockRepositoryClient{}}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, repo); err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if repo.Status.Repourl != "https://artifactory.example.com/artifactory/test-repository-docker" {
+		t.Errorf("repourl = %v, want the url of the credentials secret", repo.Status.Repourl)
+	}
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "test-repository-repo-docker-secret", Namespace: "test-namespace"}, secret); err != nil {
+		t.Fatalf("get secret: (%v)", err)
+	}
+	if got := secretRegistries(secret); !reflect.DeepEqual(got, []string{"artifactory.example.com"}) {
+		t.Errorf("registries = %v, want the host of the credentials secret", got)
+	}
+}
+
+// Unsigned JWT which expires at exp
+func testAccessToken(exp time.Time) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." + enc.EncodeToString([]byte(fmt.Sprintf(`{"sub":"repo-operator","exp":%d}`, exp.Unix()))) + ".signature"
+}
+
+func Test_RefreshedTokensAreSaved(t *testing.T) {
+	expiring := testAccessToken(time.Now().Add(30 * time.Second))
+	refreshed := testAccessToken(time.Now().Add(time.Hour))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/security/token" {
+			// The previous refresh token is revoked by the refresh
+			if r.FormValue("refresh_token") != "refresh-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"access_token":%q,"refresh_token":"refresh-2","expires_in":3600}`, refreshed)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+refreshed {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	secret := credentialsSecret(map[string]string{"url": server.URL, "access-token": expiring, "refresh-token": "refresh-1"})
+	cl := fake.NewFakeClientWithScheme(scheme.Scheme, secret)
+	watch := func() *repository.Backend {
+		backend := repository.NewBackend()
+		w := &credentialsWatcher{
+			key:     types.NamespacedName{Namespace: "repo-operator", Name: "repo-operator-repo-secret"},
+			base:    repository.DefaultClientConfig(),
+			backend: backend,
+			client:  cl,
+			log:     ctrl.Log.WithName("test"),
+		}
+		loaded := &corev1.Secret{}
+		if err := cl.Get(context.TODO(), w.key, loaded); err != nil {
+			t.Fatalf("get secret: (%v)", err)
+		}
+		w.OnAdd(loaded)
+		return backend
+	}
+
+	if _, _, _, err := watch().CreateRepositoryUser(context.TODO(), "test-repository"); err != nil {
+		t.Fatalf("CreateRepositoryUser() error = %v, want the refreshed token to be used", err)
+	}
+	saved := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Namespace: "repo-operator", Name: "repo-operator-repo-secret"}, saved); err != nil {
+		t.Fatalf("get secret: (%v)", err)
+	}
+	if string(saved.Data[CredentialsAccessKey]) != refreshed || string(saved.Data[CredentialsRefreshKey]) != "refresh-2" {
+		t.Errorf("secret = %v, want the refreshed tokens", saved.Data)
+	}
+
+	// After a restart the saved tokens are loaded, the revoked ones aren't refreshed again
+	if _, _, _, err := watch().CreateRepositoryUser(context.TODO(), "test-repository"); err != nil {
+		t.Errorf("CreateRepositoryUser() error = %v after a restart, want the saved token to be used", err)
+	}
+}
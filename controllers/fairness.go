@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// DefaultMaxConcurrentReconciles is the number of Repositories reconciled at the same time
+	DefaultMaxConcurrentReconciles = 4
+	// DefaultMaxConcurrentReconcilesPerNamespace is the number of workers a single namespace may use at the same time
+	DefaultMaxConcurrentReconcilesPerNamespace = 2
+	// DefaultRequeueBaseDelay is the delay before a failed Repository is reconciled again for the first time
+	DefaultRequeueBaseDelay = 500 * time.Millisecond
+	// DefaultRequeueMaxDelay is the longest delay before a failing Repository is reconciled again
+	DefaultRequeueMaxDelay = 5 * time.Minute
+
+	// Requeues after a failure per second and burst for a single namespace
+	namespaceRequeueRate  = 2
+	namespaceRequeueBurst = 20
+	// Delay for a request postponed because its namespace already uses its share of the workers
+	namespaceBusyDelay = 2 * time.Second
+)
+
+// namespaceLimiter limits how many workers reconcile Repositories of the same namespace at once,
+// so that a namespace with many Repositories can't hold every worker
+type namespaceLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active map[string]int
+}
+
+func newNamespaceLimiter(max int) *namespaceLimiter {
+	return &namespaceLimiter{max: max, active: map[string]int{}}
+}
+
+// Take a worker slot for the namespace, false when the namespace already uses all its slots
+func (l *namespaceLimiter) tryAcquire(namespace string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[namespace] >= l.max {
+		return false
+	}
+	l.active[namespace]++
+	return true
+}
+
+// Give back a worker slot taken with tryAcquire
+func (l *namespaceLimiter) release(namespace string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[namespace] <= 1 {
+		delete(l.active, namespace)
+		return
+	}
+	l.active[namespace]--
+}
+
+// namespaceBucketRateLimiter gives every namespace its own token bucket for requeues after a failure.
+// The default controller rate limiter shares one bucket between all items, so one namespace with many
+// failing Repositories would delay the retries of every other namespace.
+type namespaceBucketRateLimiter struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*rate.Limiter
+}
+
+func newNamespaceBucketRateLimiter(limit rate.Limit, burst int) *namespaceBucketRateLimiter {
+	return &namespaceBucketRateLimiter{limit: limit, burst: burst, limiters: map[string]*rate.Limiter{}}
+}
+
+// When implements workqueue.RateLimiter
+func (r *namespaceBucketRateLimiter) When(item interface{}) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	namespace := ""
+	if req, ok := item.(ctrl.Request); ok {
+		namespace = req.Namespace
+	}
+	limiter, ok := r.limiters[namespace]
+	if !ok {
+		limiter = rate.NewLimiter(r.limit, r.burst)
+		r.limiters[namespace] = limiter
+	}
+	return limiter.Reserve().Delay()
+}
+
+// Forget implements workqueue.RateLimiter, the bucket doesn't track single items
+func (r *namespaceBucketRateLimiter) Forget(item interface{}) {}
+
+// NumRequeues implements workqueue.RateLimiter, the bucket doesn't track single items
+func (r *namespaceBucketRateLimiter) NumRequeues(item interface{}) int {
+	return 0
+}
+
+// Rate limiter for requeues after a failure: exponential backoff per Repository and a token bucket per namespace
+func newRequeueRateLimiter(baseDelay time.Duration, maxDelay time.Duration) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		newNamespaceBucketRateLimiter(rate.Limit(namespaceRequeueRate), namespaceRequeueBurst),
+	)
+}
+
+// Delay for a postponed request, with jitter so the postponed requests of a namespace don't return at once
+func namespaceBusyRequeueDelay() time.Duration {
+	return namespaceBusyDelay/2 + time.Duration(rand.Int63n(int64(namespaceBusyDelay)))
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_namespaceLimiter(t *testing.T) {
+	l := newNamespaceLimiter(2)
+	if !l.tryAcquire("tenant-a") || !l.tryAcquire("tenant-a") {
+		t.Fatal("tryAcquire() = false, want two slots for tenant-a")
+	}
+	if l.tryAcquire("tenant-a") {
+		t.Error("tryAcquire() = true, want tenant-a limited to two slots")
+	}
+	if !l.tryAcquire("tenant-b") {
+		t.Error("tryAcquire() = false, want tenant-b not limited by tenant-a")
+	}
+	l.release("tenant-a")
+	if !l.tryAcquire("tenant-a") {
+		t.Error("tryAcquire() = false, want the released slot to be free again")
+	}
+	l.release("tenant-a")
+	l.release("tenant-a")
+	l.release("tenant-b")
+	if len(l.active) != 0 {
+		t.Errorf("active = %v, want no namespaces after release", l.active)
+	}
+}
+
+func Test_namespaceBucketRateLimiter(t *testing.T) {
+	r := newNamespaceBucketRateLimiter(rate.Limit(1), 2)
+	busy := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "tenant-a", Name: "repo"}}
+	quiet := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "tenant-b", Name: "repo"}}
+	for i := 0; i < 2; i++ {
+		if d := r.When(busy); d != 0 {
+			t.Fatalf("When() = %v within the burst, want 0", d)
+		}
+	}
+	if d := r.When(busy); d <= 0 {
+		t.Errorf("When() = %v after the burst, want a delay", d)
+	}
+	if d := r.When(quiet); d != 0 {
+		t.Errorf("When() = %v for another namespace, want 0", d)
+	}
+}
+
+func Test_newRequeueRateLimiter(t *testing.T) {
+	r := newRequeueRateLimiter(time.Second, 4*time.Second)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "tenant-a", Name: "repo"}}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, w := range want {
+		if d := r.When(req); d != w {
+			t.Errorf("When() failure %d = %v, want %v", i+1, d, w)
+		}
+	}
+	r.Forget(req)
+	if d := r.When(req); d != time.Second {
+		t.Errorf("When() after Forget = %v, want %v", d, time.Second)
+	}
+}
+
+func TestReconcilePostponesBusyNamespace(t *testing.T) {
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, &repositoryv1beta1.Repository{})
+	r := &RepositoryReconciler{
+		Client:     fake.NewFakeClientWithScheme(s),
+		Log:        ctrl.Log.WithName("test"),
+		namespaces: newNamespaceLimiter(1),
+	}
+	r.namespaces.tryAcquire("tenant-a")
+
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "tenant-a", Name: "repo"}})
+	if err != nil || result.RequeueAfter < namespaceBusyDelay/2 {
+		t.Errorf("Reconcile() = %v, %v, want the busy namespace to be requeued", result, err)
+	}
+	result, err = r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "tenant-b", Name: "repo"}})
+	if err != nil || result.RequeueAfter != 0 {
+		t.Errorf("Reconcile() = %v, %v, want tenant-b to be reconciled", result, err)
+	}
+	if r.namespaces.active["tenant-b"] != 0 {
+		t.Errorf("active = %v, want the slot of tenant-b released", r.namespaces.active)
+	}
+}
+
+// failingGetClient fails every Get
+type failingGetClient struct {
+	client.Client
+}
+
+func (c failingGetClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return errors.New("apiserver unavailable")
+}
+
+func TestReconcileRequeuesFailuresThroughRateLimiter(t *testing.T) {
+	r := &RepositoryReconciler{
+		Client:         failingGetClient{},
+		Log:            ctrl.Log.WithName("test"),
+		requeueLimiter: newRequeueRateLimiter(time.Second, time.Minute),
+	}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "tenant-a", Name: "repo"}}
+	for _, want := range []time.Duration{time.Second, 2 * time.Second} {
+		result, err := r.Reconcile(req)
+		if err != nil || result.RequeueAfter != want {
+			t.Errorf("Reconcile() = %v, %v, want a requeue after %v", result, err, want)
+		}
+	}
+}
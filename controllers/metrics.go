@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	conflictsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "repo_operator_conflicts_total",
+			Help: "Number of Repositories which ran into existing repositories they do not manage, by repotype.",
+		},
+		[]string{"repotype"},
+	)
+	driftTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "repo_operator_drift_detected_total",
+			Help: "Number of drift checks which found the Artifactory configuration drifted, by repotype.",
+		},
+		[]string{"repotype"},
+	)
+	cleanupFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "repo_operator_cleanup_failures_total",
+			Help: "Number of failed cleanups of deleted Repositories, by repotype.",
+		},
+		[]string{"repotype"},
+	)
+	credentialsRotationsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "repo_operator_credentials_rotations_total",
+			Help: "Number of rotations of the credentials of docker Repositories.",
+		},
+	)
+	repositoriesDesc = prometheus.NewDesc(
+		"repo_operator_repositories",
+		"Number of Repositories managed by the operator, by repotype and state.",
+		[]string{"repotype", "state"}, nil,
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(conflictsTotal, driftTotal, cleanupFailuresTotal, credentialsRotationsTotal)
+}
+
+// repositoryCollector counts the Repositories by repotype and state when the metrics are scraped
+type repositoryCollector struct {
+	client client.Reader
+}
+
+// Describe implements prometheus.Collector
+func (c *repositoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- repositoriesDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *repositoryCollector) Collect(ch chan<- prometheus.Metric) {
+	list := &repositoryv1beta1.RepositoryList{}
+	if err := c.client.List(context.TODO(), list); err != nil {
+		log.Error(err, "failed to list repositories for metrics")
+		ch <- prometheus.NewInvalidMetric(repositoriesDesc, err)
+		return
+	}
+	type key struct{ repotype, state string }
+	counts := map[key]int{}
+	for _, item := range list.Items {
+		state := item.Status.State
+		if state == "" {
+			state = "Pending"
+		}
+		counts[key{item.Spec.Repotype, state}]++
+	}
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(repositoriesDesc, prometheus.GaugeValue, float64(count), k.repotype, k.state)
+	}
+}
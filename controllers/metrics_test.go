@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_repositoryCollector(t *testing.T) {
+	newRepository := func(name string, repotype string, state string) *repositoryv1beta1.Repository {
+		return &repositoryv1beta1.Repository{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+			Spec:       repositoryv1beta1.RepositorySpec{Repotype: repotype},
+			Status:     repositoryv1beta1.RepositoryStatus{State: state},
+		}
+	}
+	objs := []runtime.Object{
+		newRepository("first", "npm", "ok"),
+		newRepository("second", "npm", "ok"),
+		newRepository("third", "maven", conflictState),
+		newRepository("fourth", "docker", ""),
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, &repositoryv1beta1.Repository{}, &repositoryv1beta1.RepositoryList{})
+	cl := fake.NewFakeClientWithScheme(s, objs...)
+
+	expected := `
+# HELP repo_operator_repositories Number of Repositories managed by the operator, by repotype and state.
+# TYPE repo_operator_repositories gauge
+repo_operator_repositories{repotype="docker",state="Pending"} 1
+repo_operator_repositories{repotype="maven",state="Conflict"} 1
+repo_operator_repositories{repotype="npm",state="ok"} 2
+`
+	if err := testutil.CollectAndCompare(&repositoryCollector{client: cl}, strings.NewReader(expected)); err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
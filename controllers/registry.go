@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Docker access methods of Artifactory, they decide the registry host of a docker repository
+const (
+	// DockerAccessRepositoryPath serves every docker repository on the Artifactory host, the image path starts
+	// with the repository key
+	DockerAccessRepositoryPath = "repositoryPath"
+	// DockerAccessSubdomain serves a docker repository on <repository key>.<host>
+	DockerAccessSubdomain = "subdomain"
+	// DockerAccessPort serves a docker repository on a port of its own, see repositoryv1beta1.RegistryPortAnnotation
+	DockerAccessPort = "port"
+)
+
+// DockerAccessMethods are the supported docker access methods
+var DockerAccessMethods = []string{DockerAccessRepositoryPath, DockerAccessSubdomain, DockerAccessPort}
+
+// Registry hosts of a docker repository, the keys of the auths in its docker config secret. A docker client
+// pulls and pushes through the virtual repository.
+func (r *RepositoryReconciler) registryHosts(instance *repositoryv1beta1.Repository, reqName string) ([]string, error) {
+	hosts := r.RegistryHosts
+	if len(hosts) == 0 {
+		u, err := url.Parse(r.backendURL())
+		if err != nil || u.Host == "" {
+			return nil, errors.New("the docker registry host is unknown, set the Artifactory url or the registry hosts")
+		}
+		hosts = []string{u.Host}
+	}
+	key := reqName + "-" + dockerRepoType
+	registries := []string{}
+	for _, host := range hosts {
+		switch r.DockerAccessMethod {
+		case DockerAccessSubdomain:
+			registries = append(registries, key+"."+host)
+		case DockerAccessPort:
+			port, err := strconv.Atoi(instance.Annotations[repositoryv1beta1.RegistryPortAnnotation])
+			if err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("the docker access method is %s, annotation %s must be the registry port of %s",
+					DockerAccessPort, repositoryv1beta1.RegistryPortAnnotation, key)
+			}
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			registries = append(registries, net.JoinHostPort(host, strconv.Itoa(port)))
+		default:
+			registries = append(registries, host)
+		}
+	}
+	return registries, nil
+}
+
+// Registries in the docker config of a secret, sorted
+func secretRegistries(secret *corev1.Secret) []string {
+	config := DockerConfigJSON{}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		return nil
+	}
+	registries := []string{}
+	for registry := range config.Auths {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+	return registries
+}
+
+// Whether the docker config of a secret is for other registries than the given ones
+func registriesChanged(secret *corev1.Secret, registries []string) bool {
+	want := append([]string{}, registries...)
+	sort.Strings(want)
+	return !reflect.DeepEqual(secretRegistries(secret), want)
+}
+
+// Docker config for the registries with the credentials of a secret, which may be for other registries
+func rekeyDockerConfig(secret *corev1.Secret, registries []string) ([]byte, error) {
+	config := DockerConfigJSON{}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		return nil, err
+	}
+	for _, entry := range config.Auths {
+		auths := DockerConfig{}
+		for _, registry := range registries {
+			auths[registry] = entry
+		}
+		return json.Marshal(DockerConfigJSON{Auths: auths})
+	}
+	return nil, errors.New("the docker config has no credentials")
+}
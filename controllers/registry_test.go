@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	"github.com/sebgroup/repo-operator/pkg/repository"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRepositoryReconciler_registryHosts(t *testing.T) {
+	backend := &repository.ClientConfig{BaseURL: "https://artifactory.example.com/artifactory"}
+	port := map[string]string{repositoryv1beta1.RegistryPortAnnotation: "5001"}
+	tests := []struct {
+		name        string
+		r           *RepositoryReconciler
+		annotations map[string]string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name: "Test the repository path method uses the Artifactory host",
+			r:    &RepositoryReconciler{ClientConfig: backend},
+			want: []string{"artifactory.example.com"},
+		},
+		{
+			name: "Test the subdomain method prefixes every host with the repository key",
+			r:    &RepositoryReconciler{ClientConfig: backend, DockerAccessMethod: DockerAccessSubdomain, RegistryHosts: []string{"registry.example.com", "registry.internal:8443"}},
+			want: []string{"test-docker.registry.example.com", "test-docker.registry.internal:8443"},
+		},
+		{
+			name:        "Test the port method replaces the port of every host",
+			r:           &RepositoryReconciler{ClientConfig: backend, DockerAccessMethod: DockerAccessPort, RegistryHosts: []string{"registry.example.com", "registry.internal:8443"}},
+			annotations: port,
+			want:        []string{"registry.example.com:5001", "registry.internal:5001"},
+		},
+		{
+			name:    "Test the port method needs the port annotation",
+			r:       &RepositoryReconciler{ClientConfig: backend, DockerAccessMethod: DockerAccessPort},
+			wantErr: true,
+		},
+		{
+			name:    "Test the registry is unknown without an Artifactory url",
+			r:       &RepositoryReconciler{ClientConfig: &repository.ClientConfig{}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := &repositoryv1beta1.Repository{ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: tt.annotations}}
+			got, err := tt.r.registryHosts(instance, "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("registryHosts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) && !tt.wantErr {
+				t.Errorf("registryHosts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rekeyDockerConfig(t *testing.T) {
+	r := &RepositoryReconciler{}
+	secret := r.generateRepoSecret("test-namespace", "test-repo-docker-secret", "user", "password", []string{"test-repo-docker-secret"})
+	registries := []string{"registry.example.com", "registry.internal"}
+	if !registriesChanged(secret, registries) {
+		t.Fatalf("registriesChanged() = false for a secret keyed by its name")
+	}
+	data, err := rekeyDockerConfig(secret, registries)
+	if err != nil {
+		t.Fatalf("rekeyDockerConfig() error = %v", err)
+	}
+	want := r.generateRepoSecret("test-namespace", "test-repo-docker-secret", "user", "password", registries)
+	if string(data) != string(want.Data[".dockerconfigjson"]) {
+		t.Errorf("rekeyDockerConfig() = %s, want %s", data, want.Data[".dockerconfigjson"])
+	}
+	if registriesChanged(want, []string{"registry.internal", "registry.example.com"}) {
+		t.Errorf("registriesChanged() = true for the same registries")
+	}
+}
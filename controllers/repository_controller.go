@@ -22,16 +22,26 @@ import (
 	"github.com/sebgroup/repo-operator/pkg/repository"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"os"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	"strings"
+	"time"
 )
 
 var log = logf.Log.WithName("controller_repository")
-var repositoryURL string
 
 // DockerConfig : config entry
 type DockerConfig map[string]DockerConfigEntry
@@ -43,10 +53,15 @@ type DockerConfigJSON struct {
 
 //  interface
 type rtInterface interface {
-	CreateRepositories(repoName string, repoType string, namespace string, statusCode int) (int, string, error)
-	CreatePermission(reqName string, repoType string, namespace string, users []string, repositories []string) error
-	CreateRepositoryUser(reqName string) (string, int, string, error)
-	CleanupRepository(reqName string, repoType string, namespace string) error
+	CreateRepositories(ctx context.Context, repoName string, repoType string, namespace string, statusCode int, adopt bool, recorder repository.EventRecorder) (int, string, error)
+	CreatePermission(ctx context.Context, reqName string, repoType string, namespace string, users []string, groups []string, repositories []string, recorder repository.EventRecorder) error
+	CreateRepositoryUser(ctx context.Context, reqName string) (string, int, string, error)
+	DeleteRepositoryUser(ctx context.Context, reqName string) error
+	CreateRepositoryToken(ctx context.Context, reqName string, expiresIn time.Duration) (repository.RepositoryToken, error)
+	CleanupRepository(ctx context.Context, reqName string, repoType string, namespace string) error
+	ArchiveRepository(ctx context.Context, reqName string, repoType string, namespace string) error
+	DeletePermission(ctx context.Context, reqName string, repoType string, namespace string) error
+	CheckDrift(ctx context.Context, repoName string, repoType string, namespace string, correct bool) ([]string, error)
 }
 
 // DockerConfigEntry : dockerconfig struct structure
@@ -58,38 +73,135 @@ type DockerConfigEntry struct {
 }
 
 const (
-	ins                       = "instance.Namespace"
-	rname                     = "req.Name"
-	dockerRepoType            = "docker"
-	mavenRepoType             = "maven"
-	finalizer                 = "finalizer.repositories.sebshift.io"
-	conflictState             = "Conflict"
-	suffixPackageClassLocal   = "-local"
-	suffixArtifactoryRepoUser = "-repo-user"
-	suffixSecretName          = "-repo-docker-secret"
-	snapshotSuffix            = "-snapshot"
-	releaseSuffix             = "-release"
-	failToInsertStatusCode    = "failed to insert status code"
+	ins                     = "instance.Namespace"
+	rname                   = "req.Name"
+	dockerRepoType          = "docker"
+	mavenRepoType           = "maven"
+	finalizer               = "finalizer.repositories.sebshift.io"
+	conflictState           = "Conflict"
+	conflictStateCode       = 409
+	okStateCode             = 200
+	suffixPackageClassLocal = "-local"
+	snapshotSuffix          = "-snapshot"
+	releaseSuffix           = "-release"
+	failToInsertStatusCode  = "failed to insert status code"
+
+	// Reasons used for the Repository conditions
+	reasonReconciled            = "Reconciled"
+	reasonProvisioned           = "Provisioned"
+	reasonProvisioningFailed    = "ProvisioningFailed"
+	reasonPermissionsSynced     = "Synced"
+	reasonPermissionsSyncFailed = "SyncFailed"
+	reasonCredentialsFailed     = "CredentialsFailed"
+	reasonCleanupFailed         = "CleanupFailed"
+	reasonInSync                = "InSync"
+	reasonDrifted               = "ConfigurationDrifted"
+	reasonDriftCorrected        = "DriftCorrected"
+	reasonDriftCheckFailed      = "DriftCheckFailed"
+	reasonConflict              = "Conflict"
+	reasonAlreadyExists         = "AlreadyExists"
+	reasonAdoptionRejected      = "AdoptionRejected"
+	reasonManaged               = "Managed"
+	reasonMigrated              = "Migrated"
+	reasonMigrationFailed       = "MigrationFailed"
+	reasonReconcileFailed       = "ReconcileFailed"
+	reasonCleanedUp             = "CleanedUp"
+	reasonUserCreated           = "UserCreated"
+	reasonUserDeleted           = "UserDeleted"
+	reasonTokenCreated          = "TokenCreated"
+	reasonSecretCreated         = "SecretCreated"
+	reasonSecretUpdated         = "SecretUpdated"
+	reasonSecretRecreated       = "SecretRecreated"
+	reasonServiceAccountLinked  = "ServiceAccountLinked"
+	reasonBackendConfigured     = "Configured"
+	reasonCredentialsRotated    = "CredentialsRotated"
+	reasonBackendNotConfigured  = "BackendNotConfigured"
+	messageConflict             = "repositories already exist in Artifactory and are not managed by this object"
+	messagePermissionsConflict  = "permission target is not managed while the repositories are in conflict"
 )
 
 // RepositoryReconciler reconciles a Repository object
 type RepositoryReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-	rtc    rtInterface
-}
-
-func init() {
-	repositoryURL = os.Getenv("REPOSITORY_URL")
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	rtc      rtInterface
+	// ResyncInterval is how often a Repository is reconciled to detect drift in Artifactory, zero disables it
+	ResyncInterval time.Duration
+	// CorrectDrift re-applies the desired configuration when drift is detected
+	CorrectDrift bool
+	// ReconcileTimeout is the deadline for a single reconcile, zero means no deadline
+	ReconcileTimeout time.Duration
+	// MaxConcurrentReconciles is the number of Repositories reconciled at the same time
+	MaxConcurrentReconciles int
+	// MaxConcurrentReconcilesPerNamespace is the number of workers a single namespace may use, zero means no limit
+	MaxConcurrentReconcilesPerNamespace int
+	// RequeueBaseDelay and RequeueMaxDelay bound the exponential backoff for a failing Repository
+	RequeueBaseDelay time.Duration
+	RequeueMaxDelay  time.Duration
+	// ClientConfig is the configuration of the Artifactory client, it's read from the environment when nil
+	ClientConfig *repository.ClientConfig
+	// SecretName is the template for the name of the docker config secret, it must contain {name}
+	SecretName string
+	// ImagePullServiceAccount and BuilderServiceAccount are linked to the docker config secret
+	ImagePullServiceAccount string
+	BuilderServiceAccount   string
+	// DockerAccessMethod is how Artifactory serves the docker repositories, one of DockerAccessMethods. It decides
+	// the registry host in the docker config secret, defaults to DockerAccessRepositoryPath.
+	DockerAccessMethod string
+	// RegistryHosts are the host names of the docker registry, e.g. an internal and an external one. The host of
+	// the Artifactory url is used when it's empty.
+	RegistryHosts []string
+	// CredentialsSecret is the secret the url, credentials and CA bundle of Artifactory are loaded from, it's watched
+	// for changes. The ClientConfig is used alone when it has no name.
+	CredentialsSecret types.NamespacedName
+	// DebugNamespaces are the namespaces whose Artifactory requests are logged, see repositoryv1beta1.DebugAnnotation
+	DebugNamespaces []string
+	backend         *repository.Backend
+	namespaces      *namespaceLimiter
+	requeueLimiter  workqueue.RateLimiter
 }
 
 // +kubebuilder:rbac:groups=repository.storage.sebshift.io,resources=repositories,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=repository.storage.sebshift.io,resources=repositories/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;update
 
 //Reconcile : Main reconcile function
 func (r *RepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	_ = context.Background()
+	if r.namespaces != nil {
+		if !r.namespaces.tryAcquire(req.Namespace) {
+			// The namespace already uses its share of the workers - leave this worker to the other namespaces
+			r.Log.V(1).Info("Postponing reconcile, namespace is busy", ins, req.Namespace, rname, req.Name)
+			return ctrl.Result{RequeueAfter: namespaceBusyRequeueDelay()}, nil
+		}
+		defer r.namespaces.release(req.Namespace)
+	}
+	result, err := r.reconcile(req)
+	if r.requeueLimiter == nil {
+		return result, err
+	}
+	if err != nil {
+		// Requeue through the reconciler's own rate limiter instead of the queue's default one,
+		// which shares a single token bucket between all namespaces
+		r.Log.Error(err, "Reconcile failed", ins, req.Namespace, rname, req.Name)
+		return ctrl.Result{RequeueAfter: r.requeueLimiter.When(req)}, nil
+	}
+	r.requeueLimiter.Forget(req)
+	return result, nil
+}
+
+// Reconcile a single Repository
+func (r *RepositoryReconciler) reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	if r.ReconcileTimeout > 0 {
+		// Bound the reconcile so that a hung Artifactory request doesn't block the worker
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.ReconcileTimeout)
+		defer cancel()
+	}
 	_ = r.Log.WithValues("repository", req.NamespacedName)
 
 	reqLogger := r.Log.WithValues(ins, req.Namespace, rname, req.Name)
@@ -98,7 +210,7 @@ func (r *RepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	// Fetch the Repository instance
 	instance := &repositoryv1beta1.Repository{}
 
-	err := r.Get(context.TODO(), req.NamespacedName, instance)
+	err := r.Get(ctx, req.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
@@ -110,170 +222,287 @@ func (r *RepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, err
 	}
 
-	result, err, done := r.checkForDeletion(instance, reqLogger, req)
+	if r.debugEnabled(instance) {
+		ctx = repository.WithDebug(ctx)
+	}
+
+	if r.backend != nil {
+		if err := r.backend.Configured(); err != nil {
+			return r.backendNotConfigured(instance, err, reqLogger)
+		}
+		setCondition(instance, repositoryv1beta1.ConditionBackendConfigured, metav1.ConditionTrue, reasonBackendConfigured, "")
+	}
+
+	result, err, done := r.checkForDeletion(ctx, instance, reqLogger, req)
 	if done {
 		return result, err
 	}
 
+	// Keep a copy of the observed status so that it's only written back when something changed
+	observedStatus := instance.Status.DeepCopy()
+
 	switch instance.Spec.Repotype {
 	case mavenRepoType:
-		err := r.createMavenRepositoryObjects(err, req, instance, reqLogger)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
+		err = r.createMavenRepositoryObjects(ctx, err, req, instance, reqLogger)
 	case dockerRepoType:
-		err := r.createDockerRepositoryObjects(req, instance, reqLogger)
-		if err != nil {
-			return ctrl.Result{}, err
+		err = r.createDockerRepositoryObjects(ctx, req, instance, reqLogger)
+	default:
+		err = r.createOtherRepositoryObjects(ctx, req, instance, reqLogger)
+	}
+	if err == nil && instance.Status.State != conflictState {
+		err = r.migrateRepotype(ctx, req, instance, reqLogger)
+	}
+	if err == nil && instance.Status.State != conflictState {
+		err = r.checkDrift(ctx, req, instance, reqLogger)
+	}
+	if err == nil {
+		setReadyCondition(instance)
+	}
+	if instance.Status.State == conflictState && observedStatus.State != conflictState {
+		conflictsTotal.WithLabelValues(instance.Spec.Repotype).Inc()
+		if c := findCondition(instance, repositoryv1beta1.ConditionConflict); c != nil {
+			r.recordEvent(instance, corev1.EventTypeWarning, c.Reason, c.Message)
 		}
+	}
+	if err != nil {
+		r.recordEvent(instance, corev1.EventTypeWarning, failureReason(instance), err.Error())
+	}
+	instance.Status.ObservedGeneration = instance.Generation
+	if !reflect.DeepEqual(*observedStatus, instance.Status) {
+		if statusErr := r.setStatus(instance); statusErr != nil {
+			reqLogger.Error(statusErr, failToInsertStatusCode)
+			if err == nil {
+				err = statusErr
+			}
+		}
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// All objects created successfully - requeue after the resync interval to detect drift
+	return ctrl.Result{RequeueAfter: r.requeueAfter(instance)}, nil
+}
 
-	default:
-		err := r.createOtherRepositoryObjects(req, instance, reqLogger)
-		if err != nil {
-			return ctrl.Result{}, err
+// Report that Artifactory can't be reached until the backend is configured, nothing is changed in Artifactory
+// or the cluster meanwhile
+func (r *RepositoryReconciler) backendNotConfigured(instance *repositoryv1beta1.Repository, err error, reqLogger logr.Logger) (ctrl.Result, error) {
+	reqLogger.Info("Postponing reconcile, the Artifactory backend is not configured", "reason", err.Error())
+	observedStatus := instance.Status.DeepCopy()
+	if c := findCondition(instance, repositoryv1beta1.ConditionBackendConfigured); c == nil || c.Status != metav1.ConditionFalse {
+		r.recordEvent(instance, corev1.EventTypeWarning, reasonBackendNotConfigured, err.Error())
+	}
+	_ = setFailedCondition(instance, repositoryv1beta1.ConditionBackendConfigured, reasonBackendNotConfigured, err)
+	if !reflect.DeepEqual(*observedStatus, instance.Status) {
+		if statusErr := r.setStatus(instance); statusErr != nil {
+			reqLogger.Error(statusErr, failToInsertStatusCode)
 		}
 	}
-	// All objects created successfully - don't requeue
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: backendNotConfiguredDelay}, nil
 }
 
 // Create Objects for Maven repository type
-func (r *RepositoryReconciler) createMavenRepositoryObjects(err error, req ctrl.Request, instance *repositoryv1beta1.Repository, reqLogger logr.Logger) error {
+func (r *RepositoryReconciler) createMavenRepositoryObjects(ctx context.Context, err error, req ctrl.Request, instance *repositoryv1beta1.Repository, reqLogger logr.Logger) error {
 	// Input received
 	namespace := req.Namespace
 	repositoryType := instance.Spec.Repotype
-	statusCode := instance.Status.Statuscode
+	statusCode := provisionedStatusCode(instance, req.Name)
 
 	// Naming standard defined below - change these values to meet your demands
 	mavenSnapshotRepositoryName := req.Name + "-" + repositoryType + snapshotSuffix
 	mavenReleaseRepositoryName := req.Name + "-" + repositoryType + releaseSuffix
 
 	//Create maven snapshot Local & Virtual Artifactory repository
-	code, status, err := r.rtc.CreateRepositories(mavenSnapshotRepositoryName, repositoryType, namespace, statusCode)
+	code, status, err := r.rtc.CreateRepositories(ctx, mavenSnapshotRepositoryName, repositoryType, namespace, statusCode, instance.Spec.Adopt, r.eventRecorderFor(instance))
 	if err != nil {
-		return err
+		return setProvisioningFailedCondition(instance, err)
 	}
 	//Create maven release Local & Virtual Artifactory repository
-	code, status, err = r.rtc.CreateRepositories(mavenReleaseRepositoryName, repositoryType, namespace, statusCode)
+	code, status, err = r.rtc.CreateRepositories(ctx, mavenReleaseRepositoryName, repositoryType, namespace, statusCode, instance.Spec.Adopt, r.eventRecorderFor(instance))
 	if err != nil {
-		return err
+		return setProvisioningFailedCondition(instance, err)
 	}
 	//Set status
-	if code != instance.Status.Statuscode {
-		instance.Status.Statuscode = code
-		instance.Status.State = status
-		instance.Status.Repourl = repositoryURL + "/" + req.Name + "-" + repositoryType + releaseSuffix
-		err = r.setStatus(instance)
-		if err != nil {
-			reqLogger.Error(err, failToInsertStatusCode)
-			return err
-		}
-	}
+	instance.Status.Statuscode = code
+	instance.Status.State = status
+	instance.Status.Repourl = r.backendURL() + "/" + req.Name + "-" + repositoryType + releaseSuffix
+	setProvisionedConditions(instance)
 
 	// Create Permission Object
 	if instance.Status.State != conflictState {
 		repositories := []string{req.Name + "-" + repositoryType + snapshotSuffix + suffixPackageClassLocal, req.Name + "-" + repositoryType + releaseSuffix + suffixPackageClassLocal}
-		err = r.rtc.CreatePermission(req.Name, repositoryType, namespace, instance.Spec.Users, repositories)
+		err = r.rtc.CreatePermission(ctx, req.Name, repositoryType, namespace, instance.Spec.Users, nil, repositories, r.eventRecorderFor(instance))
 		// We failed to create the permission, requeue to try again
 		if err != nil {
-			return err
+			return setFailedCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, reasonPermissionsSyncFailed, err)
 		}
+		setCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, metav1.ConditionTrue, reasonPermissionsSynced, "")
 	} else {
 		reqLogger.Info("This instance is in conflict state - do not create permission object")
+		setCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, metav1.ConditionFalse, reasonConflict, messagePermissionsConflict)
 	}
 	return nil
 }
 
 // Create Objects for Docker repository type
-func (r *RepositoryReconciler) createDockerRepositoryObjects(req ctrl.Request, instance *repositoryv1beta1.Repository, reqLogger logr.Logger) error {
+func (r *RepositoryReconciler) createDockerRepositoryObjects(ctx context.Context, req ctrl.Request, instance *repositoryv1beta1.Repository, reqLogger logr.Logger) error {
 	// Input received
 	namespace := req.Namespace
 	repositoryType := instance.Spec.Repotype
-	statusCode := instance.Status.Statuscode
+	statusCode := provisionedStatusCode(instance, req.Name)
 
 	// Naming standard defined below - change these values to meet your demands
 	dockerRepositoryName := req.Name + "-" + repositoryType
 
 	//Create Local & Virtual Repository repository
-	code, status, err := r.rtc.CreateRepositories(dockerRepositoryName, repositoryType, namespace, statusCode)
+	code, status, err := r.rtc.CreateRepositories(ctx, dockerRepositoryName, repositoryType, namespace, statusCode, instance.Spec.Adopt, r.eventRecorderFor(instance))
 	if err != nil {
-		return err
+		return setProvisioningFailedCondition(instance, err)
 	}
 	// Create required Repository docker objects
-	err = r.createWiring(instance, req)
+	err = r.createWiring(ctx, instance, req)
 	// We failed to get the secret, requeue to try again
 	if err != nil {
-		return err
+		return setFailedCondition(instance, repositoryv1beta1.ConditionCredentialsProvisioned, reasonCredentialsFailed, err)
 	}
+	setCondition(instance, repositoryv1beta1.ConditionCredentialsProvisioned, metav1.ConditionTrue, reasonProvisioned, "")
 	//Set status
-	if code != instance.Status.Statuscode {
-		instance.Status.Statuscode = code
-		instance.Status.State = status
-		instance.Status.Repourl = repositoryURL + "/" + req.Name + "-" + repositoryType
-		err = r.setStatus(instance)
-		if err != nil {
-			reqLogger.Error(err, failToInsertStatusCode)
-			return err
-		}
-	}
+	instance.Status.Statuscode = code
+	instance.Status.State = status
+	instance.Status.Repourl = r.backendURL() + "/" + req.Name + "-" + repositoryType
+	setProvisionedConditions(instance)
+
 	// Create Permission Object
 	if instance.Status.State != conflictState {
 		repositories := []string{req.Name + "-" + repositoryType + suffixPackageClassLocal}
-		users := append(instance.Spec.Users, req.Name+suffixArtifactoryRepoUser)
-		err = r.rtc.CreatePermission(req.Name, repositoryType, namespace, users, repositories)
+		// The docker config secret gets the permissions through the repository user or the group of its access tokens
+		users := instance.Spec.Users
+		var groups []string
+		if credentialsType(instance) == repositoryv1beta1.CredentialsTypeAccessToken {
+			groups = []string{r.groupName(req.Name)}
+		} else {
+			users = append(users, r.userName(req.Name))
+		}
+		err = r.rtc.CreatePermission(ctx, req.Name, repositoryType, namespace, users, groups, repositories, r.eventRecorderFor(instance))
 		// We failed to create the permission, requeue to try again
 		if err != nil {
-			return err
+			return setFailedCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, reasonPermissionsSyncFailed, err)
 		}
+		setCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, metav1.ConditionTrue, reasonPermissionsSynced, "")
 	} else {
 		reqLogger.Info("This instance is in conflict state - do not create permission object")
+		setCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, metav1.ConditionFalse, reasonConflict, messagePermissionsConflict)
 	}
 	return nil
 }
 
 // Create Objects fro all the other type of the repos.
-func (r *RepositoryReconciler) createOtherRepositoryObjects(req ctrl.Request, instance *repositoryv1beta1.Repository, reqLogger logr.Logger) error {
+func (r *RepositoryReconciler) createOtherRepositoryObjects(ctx context.Context, req ctrl.Request, instance *repositoryv1beta1.Repository, reqLogger logr.Logger) error {
 	// Input received
 	repositoryType := instance.Spec.Repotype
 	namespace := req.Namespace
-	statusCode := instance.Status.Statuscode
+	statusCode := provisionedStatusCode(instance, req.Name)
 
 	// Naming standard defined below - change these values to meet your demands
 	otherRepositoryName := req.Name + "-" + repositoryType
 
 	//Create Local & Virtual Artifactory repository
-	code, status, err := r.rtc.CreateRepositories(otherRepositoryName, repositoryType, namespace, statusCode)
+	code, status, err := r.rtc.CreateRepositories(ctx, otherRepositoryName, repositoryType, namespace, statusCode, instance.Spec.Adopt, r.eventRecorderFor(instance))
 	if err != nil {
-		return err
+		return setProvisioningFailedCondition(instance, err)
 	}
 	//Set status
-	if code != instance.Status.Statuscode {
-		instance.Status.Statuscode = code
-		instance.Status.State = status
-		instance.Status.Repourl = repositoryURL + "/" + req.Name + "-" + repositoryType
-		err = r.setStatus(instance)
-		if err != nil {
-			reqLogger.Error(err, failToInsertStatusCode)
-			return err
-		}
-	}
+	instance.Status.Statuscode = code
+	instance.Status.State = status
+	instance.Status.Repourl = r.backendURL() + "/" + req.Name + "-" + repositoryType
+	setProvisionedConditions(instance)
+
 	// Create Permission Object
 	if instance.Status.State != conflictState {
 		repositories := []string{req.Name + "-" + repositoryType + suffixPackageClassLocal}
-		err = r.rtc.CreatePermission(req.Name, repositoryType, namespace, instance.Spec.Users, repositories)
+		err = r.rtc.CreatePermission(ctx, req.Name, repositoryType, namespace, instance.Spec.Users, nil, repositories, r.eventRecorderFor(instance))
 		// We failed to create the permission, requeue to try again
 		if err != nil {
-			return err
+			return setFailedCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, reasonPermissionsSyncFailed, err)
 		}
+		setCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, metav1.ConditionTrue, reasonPermissionsSynced, "")
 	} else {
 		reqLogger.Info("This instance is in conflict state - do not create permission object")
+		setCondition(instance, repositoryv1beta1.ConditionPermissionsSynced, metav1.ConditionFalse, reasonConflict, messagePermissionsConflict)
+	}
+	return nil
+}
+
+// Record the provisioned repotype and repositories. When the repotype changed the repositories of the
+// new repotype are already provisioned, the previous ones are released according to the deletion policy
+// and their permission target is removed.
+func (r *RepositoryReconciler) migrateRepotype(ctx context.Context, req ctrl.Request, instance *repositoryv1beta1.Repository, reqLogger logr.Logger) error {
+	previousType := instance.Status.ProvisionedRepotype
+	repositories := repositoryKeys(req.Name, instance.Spec.Repotype)
+	if previousType == "" || previousType == instance.Spec.Repotype {
+		instance.Status.ProvisionedRepotype = instance.Spec.Repotype
+		instance.Status.ProvisionedRepositories = repositories
+		return nil
+	}
+	// Track the new repositories until the migration is done so that a retry doesn't take them for a conflict
+	for _, key := range repositories {
+		if !containsString(instance.Status.ProvisionedRepositories, key) {
+			instance.Status.ProvisionedRepositories = append(instance.Status.ProvisionedRepositories, key)
+		}
+	}
+	reqLogger.Info("Repotype changed - migrating repositories", "from", previousType, "to", instance.Spec.Repotype)
+	err := r.cleanupRepotype(ctx, instance, req, previousType, reqLogger)
+	if err == nil && instance.Spec.DeletionPolicy == repositoryv1beta1.DeletionPolicyRetain {
+		// The retained repositories are no longer granted to the users
+		err = r.rtc.DeletePermission(ctx, req.Name, previousType, req.Namespace)
+	}
+	if err != nil {
+		return setFailedCondition(instance, repositoryv1beta1.ConditionRepotypeMigrated, reasonMigrationFailed, err)
+	}
+	instance.Status.ProvisionedRepotype = instance.Spec.Repotype
+	instance.Status.ProvisionedRepositories = repositories
+	setCondition(instance, repositoryv1beta1.ConditionRepotypeMigrated, metav1.ConditionTrue, reasonMigrated, "migrated from "+previousType+" to "+instance.Spec.Repotype)
+	r.recordEvent(instance, corev1.EventTypeNormal, reasonMigrated, "Migrated repositories from "+previousType+" to "+instance.Spec.Repotype)
+	return nil
+}
+
+// Check the Artifactory configuration for drift and report it in the Drifted condition
+func (r *RepositoryReconciler) checkDrift(ctx context.Context, req ctrl.Request, instance *repositoryv1beta1.Repository, reqLogger logr.Logger) error {
+	drifted := []string{}
+	wasDrifted := false
+	if c := findCondition(instance, repositoryv1beta1.ConditionDrifted); c != nil && c.Status == metav1.ConditionTrue {
+		wasDrifted = true
+	}
+	for _, repoName := range repositoryNames(req.Name, instance.Spec.Repotype) {
+		d, err := r.rtc.CheckDrift(ctx, repoName, instance.Spec.Repotype, req.Namespace, r.CorrectDrift)
+		if err != nil {
+			reqLogger.Error(err, "failed to check for drift")
+			setCondition(instance, repositoryv1beta1.ConditionDrifted, metav1.ConditionUnknown, reasonDriftCheckFailed, err.Error())
+			return err
+		}
+		drifted = append(drifted, d...)
+	}
+	if len(drifted) > 0 {
+		driftTotal.WithLabelValues(instance.Spec.Repotype).Inc()
+	}
+	switch {
+	case len(drifted) == 0:
+		setCondition(instance, repositoryv1beta1.ConditionDrifted, metav1.ConditionFalse, reasonInSync, "")
+	case r.CorrectDrift:
+		reqLogger.Info("Configuration drift corrected", "settings", drifted)
+		setCondition(instance, repositoryv1beta1.ConditionDrifted, metav1.ConditionFalse, reasonDriftCorrected, "re-applied "+strings.Join(drifted, ", "))
+		r.recordEvent(instance, corev1.EventTypeNormal, reasonDriftCorrected, "Re-applied "+strings.Join(drifted, ", "))
+	default:
+		reqLogger.Info("Configuration drift detected", "settings", drifted)
+		setCondition(instance, repositoryv1beta1.ConditionDrifted, metav1.ConditionTrue, reasonDrifted, strings.Join(drifted, ", "))
+		if !wasDrifted {
+			r.recordEvent(instance, corev1.EventTypeWarning, reasonDrifted, "Configuration drifted: "+strings.Join(drifted, ", "))
+		}
 	}
 	return nil
 }
 
 // It creates service account, secret and user permission objects
-func (r *RepositoryReconciler) createWiring(instance *repositoryv1beta1.Repository, req ctrl.Request) error {
-	err := r.Get(context.TODO(), req.NamespacedName, instance)
+func (r *RepositoryReconciler) createWiring(ctx context.Context, instance *repositoryv1beta1.Repository, req ctrl.Request) error {
 	reqLogger := log.WithValues(ins, instance.Namespace, rname, req.Name)
 
 	//User list
@@ -281,23 +510,36 @@ func (r *RepositoryReconciler) createWiring(instance *repositoryv1beta1.Reposito
 	// Is this a request for docker repository type.
 	// Create secret and permission
 	reqLogger.Info("Creating user secret with permissions to be able to push to docker registry", "Namespace", instance.Namespace, "Name", instance.Name)
+	registries, err := r.registryHosts(instance, req.Name)
+	if err != nil {
+		return err
+	}
 	secretFound := &corev1.Secret{}
-	err = r.Get(context.TODO(), types.NamespacedName{Name: req.Name + suffixSecretName, Namespace: instance.Namespace}, secretFound)
+	err = r.Get(ctx, types.NamespacedName{Name: r.secretName(req.Name), Namespace: instance.Namespace}, secretFound)
 	if err != nil && errors.IsNotFound(err) {
-		// Create artifactory internal User
-		reqLogger.Info("Create artifactory internal User", "Namespace", instance.Namespace, "Name", instance.Name)
-		rp, _, _, err := r.rtc.CreateRepositoryUser(req.Name)
+		// Create artifactory internal User or access token. When the secret was lost the user exists already and
+		// gets a new password, the password in the lost secret stops working.
+		lost := instance.Status.LastRotated != nil
+		reqLogger.Info("Create artifactory credentials", "Namespace", instance.Namespace, "Name", instance.Name, "type", credentialsType(instance), "lost", lost)
+		u, p, tokenExpiry, err := r.newCredentials(ctx, instance, req)
 		if err != nil {
-			reqLogger.Error(err, "failed to create user")
+			reqLogger.Error(err, "failed to create credentials")
 			return err
 		}
-		// Add user to the list
-		users = append(users, req.Name+suffixArtifactoryRepoUser)
+		if tokenExpiry != nil {
+			r.recordEvent(instance, corev1.EventTypeNormal, reasonTokenCreated, "Created access token for group "+r.groupName(req.Name)+" expiring at "+tokenExpiry.UTC().Format(time.RFC3339))
+		} else if lost {
+			r.recordEvent(instance, corev1.EventTypeNormal, reasonUserCreated, "Reset the password of Artifactory user "+u)
+		} else {
+			r.recordEvent(instance, corev1.EventTypeNormal, reasonUserCreated, "Created Artifactory user "+u)
+			// Add user to the list
+			users = append(users, u)
+		}
 
 		// Create Secret with user and password
 		reqLogger.Info("Create Secret with user and password", "Namespace", instance.Namespace, "Name", instance.Name)
 		reqLogger.Info("Creating a new secret", "Namespace", instance.Namespace, "Name", instance.Name)
-		s := r.generateRepoSecret(instance.Namespace, req.Name+suffixSecretName, instance.Name+suffixArtifactoryRepoUser, rp)
+		s := r.generateRepoSecret(instance.Namespace, r.secretName(req.Name), u, p, registries)
 		//Set Owner reference
 		reqLogger.Info("Setting owner reference", "Namespace", instance.Namespace, "Name", instance.Name)
 		err = setOwnerReference(instance, s, r.Scheme)
@@ -305,63 +547,102 @@ func (r *RepositoryReconciler) createWiring(instance *repositoryv1beta1.Reposito
 			reqLogger.Error(err, "Unable to set owner reference")
 			return err
 		}
-		err = r.Create(context.TODO(), s)
+		err = r.Create(ctx, s)
 		if err != nil {
 			reqLogger.Error(err, "Creation of secret failed!")
 			return err
 		}
-
-		// Add secret as pull secret to default service account
-		reqLogger.Info("Add secret as pull secret to default service account and secret to builder account", "Namespace", instance.Namespace, "Name", instance.Name)
-		// Get Default service account
-		reqLogger.Info("Get Default service account", "Namespace", instance.Namespace, "Name", instance.Name)
-		defaultSA := &corev1.ServiceAccount{}
-		err = r.Get(context.TODO(), types.NamespacedName{Namespace: instance.Namespace, Name: "default"}, defaultSA)
-		if err != nil {
+		if lost {
+			r.recordEvent(instance, corev1.EventTypeWarning, reasonSecretRecreated, "Recreated secret "+s.Name+" with new credentials, the secret was deleted")
+			if tokenExpiry != nil && instance.Status.TokenExpiry == nil {
+				if err := r.deleteReplacedUser(ctx, instance, req); err != nil {
+					return err
+				}
+			}
+		} else {
+			r.recordEvent(instance, corev1.EventTypeNormal, reasonSecretCreated, "Created secret "+s.Name)
+		}
+		markRotated(instance, tokenExpiry)
+	} else if err != nil {
+		reqLogger.Info("Error is :"+err.Error(), "found.Namespace", secretFound.Namespace, "found.Name", secretFound.Name)
+		return err
+	} else if due, reason := rotationDue(instance, secretFound, time.Now()); due {
+		if err := r.rotateCredentials(ctx, instance, req, secretFound, registries, reason); err != nil {
 			return err
 		}
-
-		//Get builder service account
-		reqLogger.Info("Get Builder service account", "Namespace", instance.Namespace, "Name", instance.Name)
-		builder := &corev1.ServiceAccount{}
-		err = r.Get(context.TODO(), types.NamespacedName{Namespace: instance.Namespace, Name: "builder"}, builder)
+	} else if registriesChanged(secretFound, registries) {
+		// The credentials are kept, e.g. for a secret of an earlier release which was keyed by its own name
+		data, err := rekeyDockerConfig(secretFound, registries)
 		if err != nil {
 			return err
 		}
+		if err := r.updateSecretData(ctx, secretFound, map[string][]byte{corev1.DockerConfigJsonKey: data}); err != nil {
+			reqLogger.Error(err, "failed to update the registries of the secret")
+			return err
+		}
+		r.recordEvent(instance, corev1.EventTypeNormal, reasonSecretUpdated, "Updated the registries of secret "+secretFound.Name+" to "+strings.Join(registries, ", "))
+	} else if metav1.GetControllerOf(secretFound) == nil {
+		// A secret of an earlier release, the controller reference lets changes of the secret trigger a reconcile
+		if err := setOwnerReference(instance, secretFound, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Update(ctx, secretFound); err != nil {
+			reqLogger.Error(err, "failed to set the owner reference of the secret")
+			return err
+		}
+	}
 
-		reqLogger.Info("Link secret to default service account as pull secret", "Namespace", instance.Namespace, "Name", instance.Name)
-		// Link secret to default service account as pull secret
-		linked := linkImagePullSecret(defaultSA, req.Name+suffixSecretName)
-		if linked {
-			err = r.Update(context.TODO(), defaultSA)
-			if err != nil {
-				return err
-			}
+	// Link the secret to the service accounts, again when a link was removed
+	return r.linkServiceAccounts(ctx, instance, req)
+}
+
+// Add the docker config secret as pull secret to the image pull service account and as secret to the builder
+// service account, the service accounts which have it already aren't updated
+func (r *RepositoryReconciler) linkServiceAccounts(ctx context.Context, instance *repositoryv1beta1.Repository, req ctrl.Request) error {
+	reqLogger := log.WithValues(ins, instance.Namespace, rname, req.Name)
+	secretName := r.secretName(req.Name)
+
+	// Get Default service account
+	defaultSA := &corev1.ServiceAccount{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: r.imagePullServiceAccount()}, defaultSA)
+	if err != nil {
+		return err
+	}
+
+	//Get builder service account
+	builder := &corev1.ServiceAccount{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: r.builderServiceAccount()}, builder)
+	if err != nil {
+		return err
+	}
+
+	// Link secret to default service account as pull secret
+	if linkImagePullSecret(defaultSA, secretName) {
+		reqLogger.Info("Link secret to default service account as pull secret", "ServiceAccount", defaultSA.Name)
+		if err := r.Update(ctx, defaultSA); err != nil {
+			return err
 		}
+		r.recordEvent(instance, corev1.EventTypeNormal, reasonServiceAccountLinked, "Linked secret "+secretName+" to service account "+defaultSA.Name+" as pull secret")
+	}
 
-		reqLogger.Info("link secret to builder service account", "Namespace", instance.Namespace, "Name", instance.Name)
-		// Link secret to builder service account
-		linked = linkSecret(builder, req.Name+suffixSecretName) || linked
-		if linked {
-			err = r.Update(context.TODO(), builder)
-			if err != nil {
-				return err
-			}
+	// Link secret to builder service account
+	if linkSecret(builder, secretName) {
+		reqLogger.Info("Link secret to builder service account", "ServiceAccount", builder.Name)
+		if err := r.Update(ctx, builder); err != nil {
+			return err
 		}
-	} else if err != nil {
-		reqLogger.Info("Error is :"+err.Error(), "found.Namespace", secretFound.Namespace, "found.Name", secretFound.Name)
-		return err
+		r.recordEvent(instance, corev1.EventTypeNormal, reasonServiceAccountLinked, "Linked secret "+secretName+" to service account "+builder.Name)
 	}
 	return nil
 }
 
 // Check if the object is deleted; if yes then call the cleanup
-func (r *RepositoryReconciler) checkForDeletion(instance *repositoryv1beta1.Repository, reqLogger logr.Logger, req ctrl.Request) (ctrl.Result, error, bool) {
+func (r *RepositoryReconciler) checkForDeletion(ctx context.Context, instance *repositoryv1beta1.Repository, reqLogger logr.Logger, req ctrl.Request) (ctrl.Result, error, bool) {
 	if instance.ObjectMeta.DeletionTimestamp.IsZero() {
 		// The instance is not being deleted, add finalizer if not already there
 		reqLogger.Info("The instance is not being deleted, add finalizer if not already there")
 		if !containsString(instance.ObjectMeta.Finalizers, finalizer) {
-			result, e, b, done := r.addFinalizer(instance)
+			result, e, b, done := r.addFinalizer(ctx, instance)
 			if done {
 				return result, e, b
 			}
@@ -371,18 +652,24 @@ func (r *RepositoryReconciler) checkForDeletion(instance *repositoryv1beta1.Repo
 		// The instance is being deleted
 		reqLogger.Info("The instance is being deleted")
 		if containsString(instance.ObjectMeta.Finalizers, finalizer) {
+			// our finalizer is there, cleanup repositories in Artifactory
+			if err := r.cleanupEverything(ctx, instance, req); err != nil {
+				// if fail to delete the external dependency here, report it and return with error
+				// so that it is retried with backoff; the finalizer stays until everything is gone
+				setCondition(instance, repositoryv1beta1.ConditionReady, metav1.ConditionFalse, reasonCleanupFailed, err.Error())
+				r.recordEvent(instance, corev1.EventTypeWarning, reasonCleanupFailed, err.Error())
+				cleanupFailuresTotal.WithLabelValues(instance.Spec.Repotype).Inc()
+				if statusErr := r.setStatus(instance); statusErr != nil {
+					reqLogger.Error(statusErr, failToInsertStatusCode)
+				}
+				return ctrl.Result{}, err, true
+			}
+			r.recordEvent(instance, corev1.EventTypeNormal, reasonCleanedUp, "Cleaned up Artifactory objects")
 			// remove our finalizer from the list and update it.
-			result, e, b, done := r.removeFinalizer(instance)
+			result, e, b, done := r.removeFinalizer(ctx, instance)
 			if done {
 				return result, e, b
 			}
-			// our finalizer is there, cleanup repositories in Artifactory
-			if err := r.cleanupEverything(instance, req); err != nil {
-				// if fail to delete the external dependency here, return with error
-				// so that it can be retried
-				return ctrl.Result{}, err, true
-			}
-
 		}
 		// Return for garbage collection to do its job
 		return ctrl.Result{}, nil, true
@@ -391,86 +678,217 @@ func (r *RepositoryReconciler) checkForDeletion(instance *repositoryv1beta1.Repo
 }
 
 // Add finalizer if not already exist
-func (r *RepositoryReconciler) addFinalizer(instance *repositoryv1beta1.Repository) (ctrl.Result, error, bool, bool) {
+func (r *RepositoryReconciler) addFinalizer(ctx context.Context, instance *repositoryv1beta1.Repository) (ctrl.Result, error, bool, bool) {
 	instance.ObjectMeta.Finalizers = append(instance.ObjectMeta.Finalizers, finalizer)
-	if err := r.Update(context.TODO(), instance); err != nil {
+	if err := r.Update(ctx, instance); err != nil {
 		return ctrl.Result{}, err, true, true
 	}
 	return ctrl.Result{}, nil, false, false
 }
 
 // Remove finalizer when object is deleted
-func (r *RepositoryReconciler) removeFinalizer(instance *repositoryv1beta1.Repository) (ctrl.Result, error, bool, bool) {
+func (r *RepositoryReconciler) removeFinalizer(ctx context.Context, instance *repositoryv1beta1.Repository) (ctrl.Result, error, bool, bool) {
 	instance.ObjectMeta.Finalizers = removeString(instance.ObjectMeta.Finalizers, finalizer)
-	if err := r.Update(context.TODO(), instance); err != nil {
+	if err := r.Update(ctx, instance); err != nil {
 		return ctrl.Result{}, err, true, true
 	}
 	return ctrl.Result{}, nil, false, false
 }
 
 // It clean-up everything related to repositories
-func (r *RepositoryReconciler) cleanupEverything(instance *repositoryv1beta1.Repository, req ctrl.Request) error {
+func (r *RepositoryReconciler) cleanupEverything(ctx context.Context, instance *repositoryv1beta1.Repository, req ctrl.Request) error {
 	reqLogger := log.WithValues(ins, instance.Namespace, rname, req.Name)
 	reqLogger.Info("cleanup Everything is called....")
-	err := r.Get(context.TODO(), req.NamespacedName, instance)
 
+	repoTypes := []string{}
 	if instance.Status.State != conflictState {
-		err = r.rtc.CleanupRepository(req.Name, instance.Spec.Repotype, req.Namespace)
-		if err != nil {
-			reqLogger.Error(err, "Cleanup failed!")
-			//return err
-		}
-		if instance.Spec.Repotype == dockerRepoType {
-			err := r.cleanUpWiring(err, instance, req)
-			if err != nil {
-				return err
-			}
-		}
+		repoTypes = append(repoTypes, instance.Spec.Repotype)
 	} else {
 		reqLogger.Info("This instance is in conflict state - better not do anything just delete")
 	}
+	// Repositories of a repotype that was not completely migrated away from are still managed
+	if previousType := instance.Status.ProvisionedRepotype; previousType != "" && previousType != instance.Spec.Repotype {
+		repoTypes = append(repoTypes, previousType)
+	}
+	for _, repoType := range repoTypes {
+		if err := r.cleanupRepotype(ctx, instance, req, repoType, reqLogger); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// Cleanup the the wiring done for docker repo type
-func (r *RepositoryReconciler) cleanUpWiring(err error, instance *repositoryv1beta1.Repository, req ctrl.Request) error {
-	// Get Default service account
-	defaultSA := &corev1.ServiceAccount{}
-	err = r.Get(context.TODO(), types.NamespacedName{Namespace: instance.Namespace, Name: "default"}, defaultSA)
+// Clean-up the Artifactory objects of one repotype according to the deletion policy
+func (r *RepositoryReconciler) cleanupRepotype(ctx context.Context, instance *repositoryv1beta1.Repository, req ctrl.Request, repoType string, reqLogger logr.Logger) error {
+	var err error
+	switch instance.Spec.DeletionPolicy {
+	case repositoryv1beta1.DeletionPolicyRetain:
+		reqLogger.Info("Deletion policy is Retain - leave the Artifactory objects in place")
+	case repositoryv1beta1.DeletionPolicyArchive:
+		reqLogger.Info("Deletion policy is Archive - black out the repositories and remove the permission target")
+		err = r.rtc.ArchiveRepository(ctx, req.Name, repoType, req.Namespace)
+	default:
+		err = r.rtc.CleanupRepository(ctx, req.Name, repoType, req.Namespace)
+	}
 	if err != nil {
+		reqLogger.Error(err, "Cleanup failed!")
 		return err
 	}
+	if repoType == dockerRepoType {
+		err = r.cleanUpWiring(ctx, err, instance, req)
+		if err != nil {
+			return err
+		}
+		// The secret is garbage collected with the instance, but not when migrating away from docker
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: instance.Namespace, Name: r.secretName(req.Name)}}
+		if err = r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cleanup the the wiring done for docker repo type
+func (r *RepositoryReconciler) cleanUpWiring(ctx context.Context, err error, instance *repositoryv1beta1.Repository, req ctrl.Request) error {
+	// Service accounts which are already gone (e.g. the namespace is being deleted) have nothing to unlink
 	//Get builder service account
 	builderSA := &corev1.ServiceAccount{}
-	err = r.Get(context.TODO(), types.NamespacedName{Namespace: instance.Namespace, Name: "builder"}, builderSA)
-	if err != nil {
-		return err
-	}
-	// Un-Link builder service secret
-	builderSA = unLinkBuilderSASecret(builderSA, req.Name)
-	err = r.Update(context.TODO(), builderSA)
-	if err != nil {
+	err = r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: r.builderServiceAccount()}, builderSA)
+	if err != nil && !errors.IsNotFound(err) {
 		return err
+	} else if err == nil {
+		// Un-Link builder service secret
+		builderSA = unLinkBuilderSASecret(builderSA, r.secretName(req.Name))
+		err = r.Update(ctx, builderSA)
+		if err != nil {
+			return err
+		}
 	}
-	// Un-Link Image pull secret
-	defaultSA = unLinkDefaultSAPullSecret(defaultSA, req.Name)
-	err = r.Update(context.TODO(), defaultSA)
-	if err != nil {
+	// Get Default service account
+	defaultSA := &corev1.ServiceAccount{}
+	err = r.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: r.imagePullServiceAccount()}, defaultSA)
+	if err != nil && !errors.IsNotFound(err) {
 		return err
+	} else if err == nil {
+		// Un-Link Image pull secret
+		defaultSA = unLinkDefaultSAPullSecret(defaultSA, r.secretName(req.Name))
+		err = r.Update(ctx, defaultSA)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Record an event on the repository, the recorder is optional
+func (r *RepositoryReconciler) recordEvent(instance *repositoryv1beta1.Repository, eventtype string, reason string, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(instance, eventtype, reason, message)
+	}
+}
+
+// Recorder for the changes the repository client makes in Artifactory on behalf of the repository
+func (r *RepositoryReconciler) eventRecorderFor(instance *repositoryv1beta1.Repository) repository.EventRecorder {
+	if r.Recorder == nil {
+		return nil
+	}
+	return &repositoryEventRecorder{recorder: r.Recorder, instance: instance}
+}
+
 // SetupWithManager : setup manager
 func (r *RepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	r.rtc = repository.NewRepositoryClient()
+	if err := r.setupBackend(mgr); err != nil {
+		return err
+	}
+	if err := metrics.Registry.Register(&repositoryCollector{client: mgr.GetClient()}); err != nil {
+		return err
+	}
+	if r.MaxConcurrentReconcilesPerNamespace > 0 {
+		r.namespaces = newNamespaceLimiter(r.MaxConcurrentReconcilesPerNamespace)
+	}
+	if r.RequeueBaseDelay > 0 && r.RequeueMaxDelay > 0 {
+		r.requeueLimiter = newRequeueRateLimiter(r.RequeueBaseDelay, r.RequeueMaxDelay)
+	}
+	// The docker config secrets are owned by their Repository and the service accounts they are linked to are
+	// watched, so a deleted secret or a removed link is restored by the next reconcile
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&repositoryv1beta1.Repository{}).
+		Owns(&corev1.Secret{}).
+		Watches(&source.Kind{Type: &corev1.ServiceAccount{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.serviceAccountRepositories),
+		}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
 
-// Set status in the repository object status field
+// Requests for the docker Repositories in the namespace of a service account which the docker config secrets
+// are linked to, other service accounts are ignored
+func (r *RepositoryReconciler) serviceAccountRepositories(obj handler.MapObject) []reconcile.Request {
+	name := obj.Meta.GetName()
+	if name != r.imagePullServiceAccount() && name != r.builderServiceAccount() {
+		return nil
+	}
+	list := &repositoryv1beta1.RepositoryList{}
+	if err := r.List(context.TODO(), list, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		log.Error(err, "failed to list the Repositories of a service account", "Namespace", obj.Meta.GetNamespace(), "ServiceAccount", name)
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, repo := range list.Items {
+		if repo.Spec.Repotype == dockerRepoType && repo.DeletionTimestamp.IsZero() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: repo.Namespace, Name: repo.Name}})
+		}
+	}
+	return requests
+}
+
+// Configure the Artifactory backend from the client config and watch the credentials secret. A config which
+// isn't valid leaves the backend not configured, the Repositories report it in their conditions.
+func (r *RepositoryReconciler) setupBackend(mgr ctrl.Manager) error {
+	conf := r.ClientConfig
+	if conf == nil {
+		conf = repository.DefaultClientConfig()
+		if err := conf.ApplyEnvironment(); err != nil {
+			return err
+		}
+	}
+	r.backend = repository.NewBackend()
+	r.rtc = r.backend
+	if err := r.backend.Configure(conf); err != nil && r.CredentialsSecret.Name == "" {
+		log.Error(err, "Artifactory client is not configured")
+	}
+	if r.CredentialsSecret.Name == "" {
+		return nil
+	}
+	informer, err := mgr.GetCache().GetInformer(&corev1.Secret{})
+	if err != nil {
+		return err
+	}
+	informer.AddEventHandler(&credentialsWatcher{
+		key:     r.CredentialsSecret,
+		base:    conf,
+		backend: r.backend,
+		client:  mgr.GetClient(),
+		log:     r.Log.WithName("credentials"),
+	})
+	return nil
+}
+
+// Set status in the repository object status field through the status subresource.
+// On a conflict the latest version of the object is fetched and the status is applied again.
+// The status is written without the reconcile deadline, so that a reconcile which timed out is still reported.
 func (r *RepositoryReconciler) setStatus(instance *repositoryv1beta1.Repository) error {
-	// k8s 1.9 treats status as just another part of the object:
-	return r.Update(context.TODO(), instance)
+	status := instance.Status.DeepCopy()
+	key := types.NamespacedName{Namespace: instance.Namespace, Name: instance.Name}
+	refresh := false
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if refresh {
+			if err := r.Get(context.TODO(), key, instance); err != nil {
+				return err
+			}
+			status.DeepCopyInto(&instance.Status)
+		}
+		refresh = true
+		return r.Status().Update(context.TODO(), instance)
+	})
 }
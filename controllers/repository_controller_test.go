@@ -2,14 +2,23 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	repositoryclient "github.com/sebgroup/repo-operator/pkg/repository"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"reflect"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"strings"
 	"testing"
 	"time"
 )
@@ -79,7 +88,9 @@ func Test_DockerRepositoryController(t *testing.T) {
 	a := mockRepositoryClient{}
 
 	// Create a ReconcileMonitor object with the scheme, fake client and fake repo.
-	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &a}
+	recorder := record.NewFakeRecorder(10)
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, Recorder: recorder, rtc: &a,
+		ClientConfig: &repositoryclient.ClientConfig{BaseURL: "https://artifactory.example.com/artifactory"}}
 
 	req := ctrl.Request{
 		NamespacedName: types.NamespacedName{
@@ -121,10 +132,167 @@ func Test_DockerRepositoryController(t *testing.T) {
 		t.Errorf("repository status does not have the expected values")
 	}
 
-	if repository.Status.Repourl != repositoryURL+"/test-repository-docker" {
+	if repository.Status.Repourl != r.backendURL()+"/test-repository-docker" {
 		t.Errorf("repository  does not have the correct url name")
 	}
 
+	for _, reason := range []string{reasonUserCreated, reasonSecretCreated, reasonServiceAccountLinked, reasonServiceAccountLinked} {
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasPrefix(event, corev1.EventTypeNormal+" "+reason+" ") {
+				t.Errorf("event = %v, want reason %v", event, reason)
+			}
+		default:
+			t.Errorf("no event recorded, want reason %v", reason)
+		}
+	}
+
+	for _, conditionType := range []repositoryv1beta1.ConditionType{repositoryv1beta1.ConditionReady, repositoryv1beta1.ConditionRepositoriesProvisioned, repositoryv1beta1.ConditionPermissionsSynced} {
+		c := findCondition(repository, conditionType)
+		if c == nil || c.Status != metav1.ConditionTrue {
+			t.Errorf("repository condition %v is not true: %v", conditionType, c)
+		}
+	}
+
+}
+
+func Test_WiringIsRestored(t *testing.T) {
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-repository",
+			Namespace:  "test-namespace",
+			Finalizers: []string{finalizer},
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype: "docker",
+		},
+	}
+	saDefault := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test-namespace"}}
+	saBuilder := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "test-namespace"}}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	cl := fake.NewFakeClientWithScheme(s, repository, saDefault, saBuilder)
+	a := mockRepositoryClient{}
+	recorder := record.NewFakeRecorder(10)
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, Recorder: recorder, rtc: &a, RegistryHosts: []string{"artifactory"}}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+
+	// The secret is deleted and the pull secret is removed from the default service account
+	secretKey := types.NamespacedName{Name: "test-repository-repo-docker-secret", Namespace: "test-namespace"}
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), secretKey, secret); err != nil {
+		t.Fatalf("get secret: (%v)", err)
+	}
+	if ref := metav1.GetControllerOf(secret); ref == nil || ref.Name != "test-repository" {
+		t.Errorf("secret controller = %v, want the repository", ref)
+	}
+	if err := cl.Delete(context.TODO(), secret); err != nil {
+		t.Fatalf("delete secret: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "default", Namespace: "test-namespace"}, saDefault); err != nil {
+		t.Fatalf("get service account: (%v)", err)
+	}
+	saDefault.ImagePullSecrets = nil
+	if err := cl.Update(context.TODO(), saDefault); err != nil {
+		t.Fatalf("update service account: (%v)", err)
+	}
+
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), secretKey, secret); err != nil {
+		t.Fatalf("secret was not recreated: (%v)", err)
+	}
+	config := DockerConfigJSON{}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		t.Fatalf("secret is not a docker config: (%v)", err)
+	}
+	if entry := config.Auths["artifactory"]; entry.Auth != encodeDockerConfigFieldAuth("test-repository-repo-user", "password-2") {
+		t.Errorf("docker config = %+v, want the reset password", config)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "default", Namespace: "test-namespace"}, saDefault); err != nil {
+		t.Fatalf("get service account: (%v)", err)
+	}
+	if !reflect.DeepEqual(saDefault.ImagePullSecrets, []corev1.LocalObjectReference{{Name: secretKey.Name}}) {
+		t.Errorf("image pull secrets = %v, want the secret linked again", saDefault.ImagePullSecrets)
+	}
+	for _, want := range []string{
+		corev1.EventTypeNormal + " " + reasonUserCreated + " ",
+		corev1.EventTypeWarning + " " + reasonSecretRecreated + " ",
+		corev1.EventTypeNormal + " " + reasonServiceAccountLinked + " ",
+	} {
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasPrefix(event, want) {
+				t.Errorf("event = %v, want %v", event, want)
+			}
+		default:
+			t.Errorf("no event recorded, want %v", want)
+		}
+	}
+
+	// Nothing changes once the wiring is in place
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if a.usersCreated != 2 || len(recorder.Events) != 0 {
+		t.Errorf("created the user %d times and recorded %d more events, want the wiring kept", a.usersCreated, len(recorder.Events))
+	}
+}
+
+func TestRepositoryReconciler_serviceAccountRepositories(t *testing.T) {
+	docker := &repositoryv1beta1.Repository{
+		ObjectMeta: metav1.ObjectMeta{Name: "docker-repository", Namespace: "test-namespace"},
+		Spec:       repositoryv1beta1.RepositorySpec{Repotype: "docker"},
+	}
+	maven := &repositoryv1beta1.Repository{
+		ObjectMeta: metav1.ObjectMeta{Name: "maven-repository", Namespace: "test-namespace"},
+		Spec:       repositoryv1beta1.RepositorySpec{Repotype: "maven"},
+	}
+	other := &repositoryv1beta1.Repository{
+		ObjectMeta: metav1.ObjectMeta{Name: "other-repository", Namespace: "other-namespace"},
+		Spec:       repositoryv1beta1.RepositorySpec{Repotype: "docker"},
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, docker, &repositoryv1beta1.RepositoryList{})
+	r := &RepositoryReconciler{Client: fake.NewFakeClientWithScheme(s, docker, maven, other)}
+
+	tests := []struct {
+		name string
+		sa   string
+		want []string
+	}{
+		{name: "Test the image pull service account", sa: "default", want: []string{"docker-repository"}},
+		{name: "Test the builder service account", sa: "builder", want: []string{"docker-repository"}},
+		{name: "Test other service accounts are ignored", sa: "deployer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: tt.sa, Namespace: "test-namespace"}}
+			var got []string
+			for _, request := range r.serviceAccountRepositories(handler.MapObject{Meta: sa, Object: sa}) {
+				if request.Namespace != "test-namespace" {
+					t.Errorf("serviceAccountRepositories() = %v, want requests in the namespace of the service account", request)
+				}
+				got = append(got, request.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("serviceAccountRepositories() = %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
 
 func Test_MavenRepositoryController(t *testing.T) {
@@ -234,10 +402,17 @@ func Test_MavenRepositoryController(t *testing.T) {
 		t.Errorf("repository status does not have the expected values")
 	}
 
-	if repository.Status.Repourl != repositoryURL+"/test-repository-maven"+releaseSuffix {
+	if repository.Status.Repourl != r.backendURL()+"/test-repository-maven"+releaseSuffix {
 		t.Errorf("repository  does not have the correct url name")
 	}
 
+	for _, conditionType := range []repositoryv1beta1.ConditionType{repositoryv1beta1.ConditionReady, repositoryv1beta1.ConditionRepositoriesProvisioned, repositoryv1beta1.ConditionPermissionsSynced} {
+		c := findCondition(repository, conditionType)
+		if c == nil || c.Status != metav1.ConditionTrue {
+			t.Errorf("repository condition %v is not true: %v", conditionType, c)
+		}
+	}
+
 }
 
 func Test_DefaultRepositoryController(t *testing.T) {
@@ -347,10 +522,17 @@ func Test_DefaultRepositoryController(t *testing.T) {
 		t.Errorf("repository status does not have the expected values")
 	}
 
-	if repository.Status.Repourl != repositoryURL+"/test-repository-npm" {
+	if repository.Status.Repourl != r.backendURL()+"/test-repository-npm" {
 		t.Errorf("repository  does not have the correct url name")
 	}
 
+	for _, conditionType := range []repositoryv1beta1.ConditionType{repositoryv1beta1.ConditionReady, repositoryv1beta1.ConditionRepositoriesProvisioned, repositoryv1beta1.ConditionPermissionsSynced} {
+		c := findCondition(repository, conditionType)
+		if c == nil || c.Status != metav1.ConditionTrue {
+			t.Errorf("repository condition %v is not true: %v", conditionType, c)
+		}
+	}
+
 }
 
 func Test_OtherCleanupRepositoryController(t *testing.T) {
@@ -449,20 +631,550 @@ func Test_OtherCleanupRepositoryController(t *testing.T) {
 
 }
 
-type mockRepositoryClient struct{}
+func Test_setStatusRetriesOnConflict(t *testing.T) {
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-repository",
+			Namespace: "test-namespace",
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype: "npm",
+		},
+	}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	cl := &conflictingStatusClient{Client: fake.NewFakeClientWithScheme(s, repository), conflicts: 1}
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &mockRepositoryClient{}}
+
+	instance := repository.DeepCopy()
+	instance.Status.Statuscode = 200
+	if err := r.setStatus(instance); err != nil {
+		t.Fatalf("setStatus: (%v)", err)
+	}
+	if cl.updates != 2 {
+		t.Errorf("setStatus did not retry after conflict, updates: %v", cl.updates)
+	}
+
+	err := cl.Get(context.TODO(), types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}, repository)
+	if err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if repository.Status.Statuscode != 200 {
+		t.Errorf("repository status was not written after conflict")
+	}
+}
+
+// conflictingStatusClient fails the first status updates with a conflict
+type conflictingStatusClient struct {
+	client.Client
+	conflicts int
+	updates   int
+}
+
+func (c *conflictingStatusClient) Status() client.StatusWriter {
+	return &conflictingStatusWriter{StatusWriter: c.Client.Status(), client: c}
+}
+
+type conflictingStatusWriter struct {
+	client.StatusWriter
+	client *conflictingStatusClient
+}
+
+func (w *conflictingStatusWriter) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	w.client.updates++
+	if w.client.conflicts > 0 {
+		w.client.conflicts--
+		return errors.NewConflict(repositoryv1beta1.GroupVersion.WithResource("repositories").GroupResource(), "test-repository", fmt.Errorf("object was modified"))
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+func Test_DeletionPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        repositoryv1beta1.DeletionPolicy
+		wantCleanedUp bool
+		wantArchived  bool
+	}{
+		{name: "Default policy deletes", policy: "", wantCleanedUp: true},
+		{name: "Delete policy deletes", policy: repositoryv1beta1.DeletionPolicyDelete, wantCleanedUp: true},
+		{name: "Retain policy leaves Artifactory untouched", policy: repositoryv1beta1.DeletionPolicyRetain},
+		{name: "Archive policy archives", policy: repositoryv1beta1.DeletionPolicyArchive, wantArchived: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deletionTimestamp := metav1.NewTime(time.Now())
+			repository := &repositoryv1beta1.Repository{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "repository.storage.sebshift.io/v1beta1",
+					Kind:       "Repository",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test-repository",
+					Namespace:         "test-namespace",
+					DeletionTimestamp: &deletionTimestamp,
+					Finalizers: []string{
+						finalizer,
+					},
+				},
+				Spec: repositoryv1beta1.RepositorySpec{
+					Repotype:       "npm",
+					DeletionPolicy: tt.policy,
+				},
+			}
+
+			s := scheme.Scheme
+			s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+			cl := fake.NewFakeClientWithScheme(s, repository)
+			a := mockRepositoryClient{}
+			r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &a}
+
+			_, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}})
+			if err != nil {
+				t.Fatalf("reconcile: (%v)", err)
+			}
+			if a.cleanedUp != tt.wantCleanedUp || a.archived != tt.wantArchived {
+				t.Errorf("cleanedUp = %v, archived = %v, want %v, %v", a.cleanedUp, a.archived, tt.wantCleanedUp, tt.wantArchived)
+			}
+		})
+	}
+}
+
+func Test_DriftIsReported(t *testing.T) {
+	tests := []struct {
+		name         string
+		drifted      []string
+		correctDrift bool
+		wantStatus   metav1.ConditionStatus
+		wantReason   string
+	}{
+		{name: "No drift", drifted: nil, wantStatus: metav1.ConditionFalse, wantReason: reasonInSync},
+		{name: "Drift reported", drifted: []string{"test-repository-npm: repositories"}, wantStatus: metav1.ConditionTrue, wantReason: reasonDrifted},
+		{name: "Drift corrected", drifted: []string{"test-repository-npm: repositories"}, correctDrift: true, wantStatus: metav1.ConditionFalse, wantReason: reasonDriftCorrected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &repositoryv1beta1.Repository{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "repository.storage.sebshift.io/v1beta1",
+					Kind:       "Repository",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-repository",
+					Namespace:  "test-namespace",
+					Finalizers: []string{finalizer},
+				},
+				Spec: repositoryv1beta1.RepositorySpec{
+					Repotype: "npm",
+				},
+			}
+
+			s := scheme.Scheme
+			s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+			cl := fake.NewFakeClientWithScheme(s, repository)
+			a := mockRepositoryClient{drifted: tt.drifted}
+			r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &a, ResyncInterval: time.Minute, CorrectDrift: tt.correctDrift}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+			result, err := r.Reconcile(req)
+			if err != nil {
+				t.Fatalf("reconcile: (%v)", err)
+			}
+			if result.RequeueAfter != time.Minute {
+				t.Errorf("reconcile requeue after = %v, want %v", result.RequeueAfter, time.Minute)
+			}
+			err = cl.Get(context.TODO(), req.NamespacedName, repository)
+			if err != nil {
+				t.Fatalf("get repository: (%v)", err)
+			}
+			c := findCondition(repository, repositoryv1beta1.ConditionDrifted)
+			if c == nil || c.Status != tt.wantStatus || c.Reason != tt.wantReason {
+				t.Errorf("repository drifted condition = %v, want %v %v", c, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_RejectedAdoptionIsAConflict(t *testing.T) {
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-repository",
+			Namespace:  "test-namespace",
+			Finalizers: []string{finalizer},
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype: "npm",
+			Adopt:    true,
+		},
+	}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	cl := fake.NewFakeClientWithScheme(s, repository)
+	a := mockRepositoryClient{createErr: &repositoryclient.AdoptionError{Key: "test-repository-npm-local", Reason: "package type maven does not match npm"}}
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &a}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+	_, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("rejected adoption should not be retried: (%v)", err)
+	}
+	err = cl.Get(context.TODO(), req.NamespacedName, repository)
+	if err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if repository.Status.State != conflictState {
+		t.Errorf("repository state = %v, want %v", repository.Status.State, conflictState)
+	}
+	for _, conditionType := range []repositoryv1beta1.ConditionType{repositoryv1beta1.ConditionConflict, repositoryv1beta1.ConditionReady} {
+		if c := findCondition(repository, conditionType); c == nil || c.Reason != reasonAdoptionRejected {
+			t.Errorf("repository condition %v = %v, want reason %v", conditionType, c, reasonAdoptionRejected)
+		}
+	}
+}
+
+func Test_CleanupFailureKeepsFinalizer(t *testing.T) {
+	deletionTimestamp := metav1.NewTime(time.Now())
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "test-repository",
+			Namespace:         "test-namespace",
+			DeletionTimestamp: &deletionTimestamp,
+			Finalizers: []string{
+				finalizer,
+			},
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype: "npm",
+			Users:    []string{"testuser"},
+		},
+	}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	cl := fake.NewFakeClientWithScheme(s, repository)
+
+	// Artifactory is unavailable during the cleanup
+	a := mockRepositoryClient{cleanupErr: fmt.Errorf("artifactory unavailable")}
+	recorder := record.NewFakeRecorder(10)
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, Recorder: recorder, rtc: &a}
+
+	req := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "test-repository",
+			Namespace: "test-namespace",
+		},
+	}
+
+	_, err := r.Reconcile(req)
+	if err == nil {
+		t.Fatalf("reconcile did not return the cleanup error")
+	}
+
+	err = cl.Get(context.TODO(), req.NamespacedName, repository)
+	if err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if !containsString(repository.GetFinalizers(), finalizer) {
+		t.Errorf("finalizer was removed before cleanup succeeded")
+	}
+	if c := findCondition(repository, repositoryv1beta1.ConditionReady); c == nil || c.Reason != reasonCleanupFailed {
+		t.Errorf("repository does not report the failed cleanup: %v", c)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, corev1.EventTypeWarning+" "+reasonCleanupFailed+" ") {
+		t.Errorf("event = %v, want a %v warning", event, reasonCleanupFailed)
+	}
+
+	// Artifactory is back, the retry releases the finalizer
+	a.cleanupErr = nil
+	_, err = r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	deleted := &repositoryv1beta1.Repository{}
+	err = cl.Get(context.TODO(), req.NamespacedName, deleted)
+	if err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if containsString(deleted.GetFinalizers(), finalizer) {
+		t.Errorf("finalizer was not removed after cleanup succeeded")
+	}
+}
+
+func Test_RepotypeMigration(t *testing.T) {
+	tests := []struct {
+		name                  string
+		policy                repositoryv1beta1.DeletionPolicy
+		cleanupErr            error
+		wantCleanedUpTypes    []string
+		wantPermissionDeleted []string
+		wantProvisionedType   string
+	}{
+		{name: "Delete policy removes the previous repositories", wantCleanedUpTypes: []string{"maven"}, wantProvisionedType: "npm"},
+		{name: "Retain policy only moves the permission target", policy: repositoryv1beta1.DeletionPolicyRetain, wantPermissionDeleted: []string{"maven"}, wantProvisionedType: "npm"},
+		{name: "Failed cleanup keeps the previous repotype", cleanupErr: fmt.Errorf("artifactory unavailable"), wantCleanedUpTypes: []string{"maven"}, wantProvisionedType: "maven"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &repositoryv1beta1.Repository{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "repository.storage.sebshift.io/v1beta1",
+					Kind:       "Repository",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test-repository",
+					Namespace:  "test-namespace",
+					Finalizers: []string{finalizer},
+				},
+				Spec: repositoryv1beta1.RepositorySpec{
+					Repotype:       "npm",
+					DeletionPolicy: tt.policy,
+				},
+				Status: repositoryv1beta1.RepositoryStatus{
+					Statuscode:              200,
+					State:                   "ok",
+					ProvisionedRepotype:     "maven",
+					ProvisionedRepositories: repositoryKeys("test-repository", "maven"),
+				},
+			}
+
+			s := scheme.Scheme
+			s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+			cl := fake.NewFakeClientWithScheme(s, repository)
+			a := mockRepositoryClient{cleanupErr: tt.cleanupErr}
+			r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &a}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+			_, err := r.Reconcile(req)
+			if (err != nil) != (tt.cleanupErr != nil) {
+				t.Fatalf("reconcile: (%v)", err)
+			}
+			if !reflect.DeepEqual(a.cleanedUpTypes, tt.wantCleanedUpTypes) || !reflect.DeepEqual(a.permissionDeleted, tt.wantPermissionDeleted) {
+				t.Errorf("cleaned up %v, permissions deleted %v, want %v, %v", a.cleanedUpTypes, a.permissionDeleted, tt.wantCleanedUpTypes, tt.wantPermissionDeleted)
+			}
+			migrated := &repositoryv1beta1.Repository{}
+			err = cl.Get(context.TODO(), req.NamespacedName, migrated)
+			if err != nil {
+				t.Fatalf("get repository: (%v)", err)
+			}
+			if migrated.Status.ProvisionedRepotype != tt.wantProvisionedType {
+				t.Errorf("provisioned repotype = %v, want %v", migrated.Status.ProvisionedRepotype, tt.wantProvisionedType)
+			}
+			for _, key := range repositoryKeys("test-repository", "npm") {
+				if !containsString(migrated.Status.ProvisionedRepositories, key) {
+					t.Errorf("provisioned repositories %v do not contain %v", migrated.Status.ProvisionedRepositories, key)
+				}
+			}
+			if c := findCondition(migrated, repositoryv1beta1.ConditionRepotypeMigrated); c == nil || (c.Status == metav1.ConditionTrue) != (tt.cleanupErr == nil) {
+				t.Errorf("repository migrated condition = %v", c)
+			}
+		})
+	}
+}
+
+func Test_RevertedMigrationIntoConflict(t *testing.T) {
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-repository",
+			Namespace:  "test-namespace",
+			Finalizers: []string{finalizer},
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype: "npm",
+		},
+		Status: repositoryv1beta1.RepositoryStatus{
+			Statuscode:              200,
+			State:                   "ok",
+			ProvisionedRepotype:     "maven",
+			ProvisionedRepositories: repositoryKeys("test-repository", "maven"),
+		},
+	}
 
-func (m *mockRepositoryClient) CreateRepositories(repoName string, repoType string, namespace string, statusCode int) (int, string, error) {
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	cl := fake.NewFakeClientWithScheme(s, repository)
+	// The npm repositories belong to someone else, the maven ones are the operator's own
+	a := mockRepositoryClient{existingTypes: []string{"maven", "npm"}}
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &a}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, repository); err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if repository.Status.State != conflictState || repository.Status.ProvisionedRepotype != "maven" || len(a.cleanedUpTypes) != 0 {
+		t.Fatalf("state = %v, provisioned repotype = %v, cleaned up %v, want a conflict which keeps the maven repositories",
+			repository.Status.State, repository.Status.ProvisionedRepotype, a.cleanedUpTypes)
+	}
+
+	// Reverting the repotype finds the provisioned maven repositories, they are no conflict
+	repository.Spec.Repotype = "maven"
+	if err := cl.Update(context.TODO(), repository); err != nil {
+		t.Fatalf("update repository: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, repository); err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if repository.Status.State == conflictState || repository.Status.Statuscode != 200 {
+		t.Errorf("state = %v (%d), want the maven repositories managed again", repository.Status.State, repository.Status.Statuscode)
+	}
+	if c := findCondition(repository, repositoryv1beta1.ConditionConflict); c == nil || c.Status != metav1.ConditionFalse {
+		t.Errorf("repository conflict condition = %v", c)
+	}
+}
+
+type mockRepositoryClient struct {
+	drifted           []string
+	createErr         error
+	existingTypes     []string
+	cleanupErr        error
+	cleanedUp         bool
+	archived          bool
+	cleanedUpTypes    []string
+	permissionDeleted []string
+	usersCreated      int
+	usersDeleted      int
+	tokensCreated     int
+	permissionGroups  []string
+}
+
+func (m *mockRepositoryClient) CreateRepositories(ctx context.Context, repoName string, repoType string, namespace string, statusCode int, adopt bool, recorder repositoryclient.EventRecorder) (int, string, error) {
+	if m.createErr != nil {
+		return 409, "Conflict", m.createErr
+	}
+	if containsString(m.existingTypes, repoType) && statusCode != 200 && !adopt {
+		return 409, "Conflict", nil
+	}
 	return 200, "ok", nil
 }
 
-func (m *mockRepositoryClient) CreatePermission(reqName string, repoType string, namespace string, users []string, repositories []string) error {
+func (m *mockRepositoryClient) CreatePermission(ctx context.Context, reqName string, repoType string, namespace string, users []string, groups []string, repositories []string, recorder repositoryclient.EventRecorder) error {
+	m.permissionGroups = groups
 	return nil
 }
 
-func (m *mockRepositoryClient) CreateRepositoryUser(reqName string) (string, int, string, error) {
+func (m *mockRepositoryClient) CreateRepositoryToken(ctx context.Context, reqName string, expiresIn time.Duration) (repositoryclient.RepositoryToken, error) {
+	m.tokensCreated++
+	return repositoryclient.RepositoryToken{
+		Username: reqName + "-repo-user",
+		Token:    fmt.Sprintf("token-%d", m.tokensCreated),
+		Expiry:   time.Now().Add(expiresIn),
+	}, nil
+}
+
+func (m *mockRepositoryClient) CreateRepositoryUser(ctx context.Context, reqName string) (string, int, string, error) {
+	m.usersCreated++
+	if m.usersCreated > 1 {
+		return fmt.Sprintf("password-%d", m.usersCreated), 200, "ok", nil
+	}
 	return "password", 200, "ok", nil
 }
 
-func (m *mockRepositoryClient) CleanupRepository(reqName string, repoType string, namespace string) error {
+func (m *mockRepositoryClient) DeleteRepositoryUser(ctx context.Context, reqName string) error {
+	m.usersDeleted++
 	return nil
 }
+
+func (m *mockRepositoryClient) CleanupRepository(ctx context.Context, reqName string, repoType string, namespace string) error {
+	m.cleanedUp = true
+	m.cleanedUpTypes = append(m.cleanedUpTypes, repoType)
+	return m.cleanupErr
+}
+
+func (m *mockRepositoryClient) CheckDrift(ctx context.Context, repoName string, repoType string, namespace string, correct bool) ([]string, error) {
+	return m.drifted, nil
+}
+
+func (m *mockRepositoryClient) ArchiveRepository(ctx context.Context, reqName string, repoType string, namespace string) error {
+	m.archived = true
+	return m.cleanupErr
+}
+
+func (m *mockRepositoryClient) DeletePermission(ctx context.Context, reqName string, repoType string, namespace string) error {
+	m.permissionDeleted = append(m.permissionDeleted, repoType)
+	return m.cleanupErr
+}
+
+func Test_BackendNotConfigured(t *testing.T) {
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-repository",
+			Namespace:  "test-namespace",
+			Finalizers: []string{finalizer},
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype: "npm",
+		},
+	}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	cl := fake.NewFakeClientWithScheme(s, repository)
+	recorder := record.NewFakeRecorder(10)
+	backend := repositoryclient.NewBackend()
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, Recorder: recorder, rtc: backend, backend: backend}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+	for i := 0; i < 2; i++ {
+		result, err := r.Reconcile(req)
+		if err != nil || result.RequeueAfter != backendNotConfiguredDelay {
+			t.Fatalf("Reconcile() = %v, %v, want a requeue after %v", result, err, backendNotConfiguredDelay)
+		}
+	}
+	err := cl.Get(context.TODO(), req.NamespacedName, repository)
+	if err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	for _, conditionType := range []repositoryv1beta1.ConditionType{repositoryv1beta1.ConditionBackendConfigured, repositoryv1beta1.ConditionReady} {
+		if c := findCondition(repository, conditionType); c == nil || c.Status != metav1.ConditionFalse || c.Reason != reasonBackendNotConfigured {
+			t.Errorf("repository condition %v = %v, want reason %v", conditionType, c, reasonBackendNotConfigured)
+		}
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("recorded %d events, want a single event for the transition", len(recorder.Events))
+	}
+
+	// The credentials are loaded, the next reconcile provisions the repositories
+	if err := backend.Configure(&repositoryclient.ClientConfig{BaseURL: "https://artifactory", AuthMethod: "token", Token: "token"}); err != nil {
+		t.Fatalf("Configure() = %v", err)
+	}
+	r.rtc = &mockRepositoryClient{}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	err = cl.Get(context.TODO(), req.NamespacedName, repository)
+	if err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	for _, conditionType := range []repositoryv1beta1.ConditionType{repositoryv1beta1.ConditionBackendConfigured, repositoryv1beta1.ConditionReady} {
+		if c := findCondition(repository, conditionType); c == nil || c.Status != metav1.ConditionTrue {
+			t.Errorf("repository condition %v = %v, want true", conditionType, c)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// defaultTokenLifetime is how long an access token is valid when the Repository doesn't set it
+const defaultTokenLifetime = 24 * time.Hour
+
+// Type of the credentials in the docker config secret of the repository
+func credentialsType(instance *repositoryv1beta1.Repository) repositoryv1beta1.CredentialsType {
+	if c := instance.Spec.Credentials; c != nil && c.Type != "" {
+		return c.Type
+	}
+	return repositoryv1beta1.CredentialsTypeUser
+}
+
+// How long an access token of the repository is valid. A shorter lifetime than the webhook accepts is raised
+// to the minimum, Artifactory doesn't expire a token with a lifetime of 0s.
+func tokenLifetime(instance *repositoryv1beta1.Repository) time.Duration {
+	if c := instance.Spec.Credentials; c != nil && c.TokenLifetime != nil {
+		if c.TokenLifetime.Duration < repositoryv1beta1.MinTokenLifetime {
+			return repositoryv1beta1.MinTokenLifetime
+		}
+		return c.TokenLifetime.Duration
+	}
+	return defaultTokenLifetime
+}
+
+// When the access token in the secret is renewed, a third of its lifetime before it expires. There is
+// none for user credentials.
+func tokenRenewal(instance *repositoryv1beta1.Repository) (time.Time, bool) {
+	if instance.Status.TokenExpiry == nil {
+		return time.Time{}, false
+	}
+	return instance.Status.TokenExpiry.Add(-tokenLifetime(instance) / 3), true
+}
+
+// Interval the credentials of the repository are renewed in, zero never renews them. A shorter interval than
+// the webhook accepts is raised to the minimum.
+func rotationInterval(instance *repositoryv1beta1.Repository) time.Duration {
+	if c := instance.Spec.Credentials; c != nil && c.RotationInterval != nil {
+		if d := c.RotationInterval.Duration; d > 0 && d < repositoryv1beta1.MinRotationInterval {
+			return repositoryv1beta1.MinRotationInterval
+		}
+		return c.RotationInterval.Duration
+	}
+	return 0
+}
+
+// When the credentials were last generated, the secret of a repository created before the rotation
+// was introduced counts from its creation
+func lastRotated(instance *repositoryv1beta1.Repository, secret *corev1.Secret) time.Time {
+	if instance.Status.LastRotated != nil {
+		return instance.Status.LastRotated.Time
+	}
+	return secret.CreationTimestamp.Time
+}
+
+// Whether the credentials have to be renewed now and why
+func rotationDue(instance *repositoryv1beta1.Repository, secret *corev1.Secret, now time.Time) (bool, string) {
+	if request := instance.Annotations[repositoryv1beta1.RotateCredentialsAnnotation]; request != "" && request != instance.Status.RotationRequest {
+		return true, "rotation requested"
+	}
+	// The secret holds the other type of credentials when the type was changed
+	switch t := credentialsType(instance); {
+	case t == repositoryv1beta1.CredentialsTypeAccessToken && instance.Status.TokenExpiry == nil:
+		return true, "credentials type changed to " + string(t)
+	case t == repositoryv1beta1.CredentialsTypeUser && instance.Status.TokenExpiry != nil:
+		return true, "credentials type changed to " + string(t)
+	}
+	if renewal, ok := tokenRenewal(instance); ok && !now.Before(renewal) {
+		return true, "access token expires at " + instance.Status.TokenExpiry.UTC().Format(time.RFC3339)
+	}
+	interval := rotationInterval(instance)
+	if interval > 0 && !now.Before(lastRotated(instance, secret).Add(interval)) {
+		return true, "rotation interval of " + interval.String() + " elapsed"
+	}
+	return false, ""
+}
+
+// Record that the credentials were generated now, a rotation request made before is handled by that.
+// The token expiry is nil for user credentials.
+func markRotated(instance *repositoryv1beta1.Repository, tokenExpiry *metav1.Time) {
+	now := metav1.Now()
+	instance.Status.LastRotated = &now
+	instance.Status.RotationRequest = instance.Annotations[repositoryv1beta1.RotateCredentialsAnnotation]
+	instance.Status.TokenExpiry = tokenExpiry
+}
+
+// Generate credentials of the type of the repository: a new password of the repository user, which is created
+// or replaced, or a new access token for the group of the repository. The token expiry is nil for a password.
+func (r *RepositoryReconciler) newCredentials(ctx context.Context, instance *repositoryv1beta1.Repository, req ctrl.Request) (string, string, *metav1.Time, error) {
+	if credentialsType(instance) == repositoryv1beta1.CredentialsTypeAccessToken {
+		token, err := r.rtc.CreateRepositoryToken(ctx, req.Name, tokenLifetime(instance))
+		if err != nil {
+			return "", "", nil, err
+		}
+		expiry := metav1.NewTime(token.Expiry)
+		return token.Username, token.Token, &expiry, nil
+	}
+	rp, _, _, err := r.rtc.CreateRepositoryUser(ctx, req.Name)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return r.userName(req.Name), rp, nil, nil
+}
+
+// Renew the password of the repository user or the access token and rewrite the docker config secret with it.
+// The password is replaced in Artifactory first, so the secret never holds a password which isn't valid yet; pulls
+// which already started keep the registry token they were issued. A previous access token stays valid until it
+// expires. When the secret can't be written the rotation isn't recorded and the next reconcile renews the
+// credentials again.
+func (r *RepositoryReconciler) rotateCredentials(ctx context.Context, instance *repositoryv1beta1.Repository, req ctrl.Request, secret *corev1.Secret, registries []string, reason string) error {
+	reqLogger := log.WithValues(ins, instance.Namespace, rname, req.Name)
+	reqLogger.Info("Rotating the credentials of the repository", "reason", reason, "type", credentialsType(instance))
+	u, p, tokenExpiry, err := r.newCredentials(ctx, instance, req)
+	if err != nil {
+		reqLogger.Error(err, "failed to renew the credentials of the repository")
+		return err
+	}
+	data := r.generateRepoSecret(instance.Namespace, secret.Name, u, p, registries).Data
+	if err := r.updateSecretData(ctx, secret, data); err != nil {
+		reqLogger.Error(err, "failed to write the renewed credentials to the secret")
+		return err
+	}
+	if tokenExpiry != nil && instance.Status.TokenExpiry == nil {
+		if err := r.deleteReplacedUser(ctx, instance, req); err != nil {
+			return err
+		}
+	}
+	markRotated(instance, tokenExpiry)
+	credentialsRotationsTotal.Inc()
+	if tokenExpiry != nil {
+		r.recordEvent(instance, corev1.EventTypeNormal, reasonCredentialsRotated,
+			"Renewed the access token for group "+r.groupName(req.Name)+" in secret "+secret.Name+": "+reason)
+	} else {
+		r.recordEvent(instance, corev1.EventTypeNormal, reasonCredentialsRotated,
+			"Rotated the password of Artifactory user "+u+" in secret "+secret.Name+": "+reason)
+	}
+	return nil
+}
+
+// Delete the repository user once the secret holds an access token instead of its password, the tokens are
+// scoped to the group of the repository. When the user can't be deleted the switch isn't recorded, so the next
+// reconcile renews the token and deletes the user again.
+func (r *RepositoryReconciler) deleteReplacedUser(ctx context.Context, instance *repositoryv1beta1.Repository, req ctrl.Request) error {
+	reqLogger := log.WithValues(ins, instance.Namespace, rname, req.Name)
+	if err := r.rtc.DeleteRepositoryUser(ctx, req.Name); err != nil {
+		reqLogger.Error(err, "failed to delete the repository user replaced by access tokens")
+		return err
+	}
+	r.recordEvent(instance, corev1.EventTypeNormal, reasonUserDeleted, "Deleted Artifactory user "+r.userName(req.Name)+", the secret holds an access token")
+	return nil
+}
+
+// Replace the data of a secret in a single update, on a conflict the latest version of the secret is fetched
+// and the data is replaced again
+func (r *RepositoryReconciler) updateSecretData(ctx context.Context, secret *corev1.Secret, data map[string][]byte) error {
+	key := types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret.Data = data
+		err := r.Update(ctx, secret)
+		if errors.IsConflict(err) {
+			if getErr := r.Get(ctx, key, secret); getErr != nil {
+				return getErr
+			}
+		}
+		return err
+	})
+}
+
+// Requeue after the resync interval, or earlier when the credentials are due for rotation or the access token
+// for renewal before
+func (r *RepositoryReconciler) requeueAfter(instance *repositoryv1beta1.Repository) time.Duration {
+	requeue := r.ResyncInterval
+	due := []time.Time{}
+	if interval := rotationInterval(instance); interval > 0 && instance.Status.LastRotated != nil {
+		due = append(due, instance.Status.LastRotated.Add(interval))
+	}
+	if renewal, ok := tokenRenewal(instance); ok {
+		due = append(due, renewal)
+	}
+	for _, at := range due {
+		until := time.Until(at)
+		if until < time.Second {
+			until = time.Second
+		}
+		if requeue == 0 || until < requeue {
+			requeue = until
+		}
+	}
+	return requeue
+}
@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_rotationDue(t *testing.T) {
+	now := time.Now()
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-48 * time.Hour))}}
+	daily := &repositoryv1beta1.CredentialsSpec{RotationInterval: &metav1.Duration{Duration: 24 * time.Hour}}
+	recently := metav1.NewTime(now.Add(-time.Hour))
+	tests := []struct {
+		name        string
+		credentials *repositoryv1beta1.CredentialsSpec
+		annotations map[string]string
+		status      repositoryv1beta1.RepositoryStatus
+		want        bool
+	}{
+		{name: "Test no rotation without an interval", want: false},
+		{name: "Test a secret older than the interval is rotated", credentials: daily, want: true},
+		{name: "Test recently rotated credentials are kept", credentials: daily, status: repositoryv1beta1.RepositoryStatus{LastRotated: &recently}, want: false},
+		{name: "Test a new rotation request", annotations: map[string]string{repositoryv1beta1.RotateCredentialsAnnotation: "2026-10-17T10:00:00Z"}, want: true},
+		{
+			name:        "Test user credentials are replaced by an access token",
+			credentials: &repositoryv1beta1.CredentialsSpec{Type: repositoryv1beta1.CredentialsTypeAccessToken},
+			status:      repositoryv1beta1.RepositoryStatus{LastRotated: &recently},
+			want:        true,
+		},
+		{
+			name:        "Test an access token is kept until a third of its lifetime is left",
+			credentials: &repositoryv1beta1.CredentialsSpec{Type: repositoryv1beta1.CredentialsTypeAccessToken},
+			status:      repositoryv1beta1.RepositoryStatus{LastRotated: &recently, TokenExpiry: &metav1.Time{Time: now.Add(9 * time.Hour)}},
+			want:        false,
+		},
+		{
+			name:        "Test an access token is renewed before it expires",
+			credentials: &repositoryv1beta1.CredentialsSpec{Type: repositoryv1beta1.CredentialsTypeAccessToken},
+			status:      repositoryv1beta1.RepositoryStatus{LastRotated: &recently, TokenExpiry: &metav1.Time{Time: now.Add(7 * time.Hour)}},
+			want:        true,
+		},
+		{
+			name:   "Test an access token is replaced by user credentials",
+			status: repositoryv1beta1.RepositoryStatus{LastRotated: &recently, TokenExpiry: &metav1.Time{Time: now.Add(9 * time.Hour)}},
+			want:   true,
+		},
+		{
+			name:        "Test a handled rotation request",
+			annotations: map[string]string{repositoryv1beta1.RotateCredentialsAnnotation: "2026-10-17T10:00:00Z"},
+			status:      repositoryv1beta1.RepositoryStatus{LastRotated: &recently, RotationRequest: "2026-10-17T10:00:00Z"},
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := &repositoryv1beta1.Repository{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       repositoryv1beta1.RepositorySpec{Repotype: "docker", Credentials: tt.credentials},
+				Status:     tt.status,
+			}
+			if got, reason := rotationDue(instance, secret, now); got != tt.want {
+				t.Errorf("rotationDue() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryReconciler_requeueAfter(t *testing.T) {
+	r := &RepositoryReconciler{ResyncInterval: 10 * time.Minute}
+	instance := &repositoryv1beta1.Repository{}
+	if got := r.requeueAfter(instance); got != 10*time.Minute {
+		t.Errorf("requeueAfter() = %v, want the resync interval", got)
+	}
+	lastRotated := metav1.NewTime(time.Now().Add(-time.Hour))
+	instance.Status.LastRotated = &lastRotated
+	instance.Spec.Credentials = &repositoryv1beta1.CredentialsSpec{RotationInterval: &metav1.Duration{Duration: time.Hour + 2*time.Minute}}
+	if got := r.requeueAfter(instance); got > 2*time.Minute || got < time.Minute {
+		t.Errorf("requeueAfter() = %v, want the time until the rotation", got)
+	}
+}
+
+func Test_CredentialsRotation(t *testing.T) {
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-repository",
+			Namespace:  "test-namespace",
+			Finalizers: []string{finalizer},
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype:    "docker",
+			Credentials: &repositoryv1beta1.CredentialsSpec{RotationInterval: &metav1.Duration{Duration: 24 * time.Hour}},
+		},
+	}
+	r := &RepositoryReconciler{}
+	secret := r.generateRepoSecret("test-namespace", "test-repository-repo-docker-secret", "test-repository-repo-user", "initial", []string{"artifactory"})
+	secret.CreationTimestamp = metav1.NewTime(time.Now().Add(-48 * time.Hour))
+
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	defaultSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test-namespace"}}
+	builderSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "test-namespace"}}
+	cl := fake.NewFakeClientWithScheme(s, repository, secret, defaultSA, builderSA)
+	a := mockRepositoryClient{usersCreated: 1}
+	recorder := record.NewFakeRecorder(10)
+	r = &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, Recorder: recorder, rtc: &a, ResyncInterval: 10 * time.Minute, RegistryHosts: []string{"artifactory"}}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+	result, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if result.RequeueAfter != 10*time.Minute {
+		t.Errorf("Reconcile() requeue after %v, want the resync interval", result.RequeueAfter)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, repository); err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if repository.Status.LastRotated == nil || time.Since(repository.Status.LastRotated.Time) > time.Minute {
+		t.Errorf("lastRotated = %v, want the time of the rotation", repository.Status.LastRotated)
+	}
+	rotated := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, rotated); err != nil {
+		t.Fatalf("get secret: (%v)", err)
+	}
+	config := DockerConfigJSON{}
+	if err := json.Unmarshal(rotated.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		t.Fatalf("secret is not a docker config: (%v)", err)
+	}
+	if entry := config.Auths["artifactory"]; entry.Auth != encodeDockerConfigFieldAuth("test-repository-repo-user", "password-2") {
+		t.Errorf("docker config = %+v, want the renewed password", config)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, corev1.EventTypeNormal+" "+reasonCredentialsRotated+" ") {
+		t.Errorf("event = %v, want reason %v", event, reasonCredentialsRotated)
+	}
+
+	// The credentials were just rotated, a rotation request renews them again once
+	repository.Annotations = map[string]string{repositoryv1beta1.RotateCredentialsAnnotation: "now"}
+	if err := cl.Update(context.TODO(), repository); err != nil {
+		t.Fatalf("update repository: (%v)", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	if a.usersCreated != 3 {
+		t.Errorf("renewed the password %d times, want once per rotation", a.usersCreated-1)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, repository); err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if repository.Status.RotationRequest != "now" {
+		t.Errorf("rotationRequest = %q, want the handled request", repository.Status.RotationRequest)
+	}
+}
+
+func Test_AccessTokenCredentials(t *testing.T) {
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-repository",
+			Namespace:  "test-namespace",
+			Finalizers: []string{finalizer},
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype: "docker",
+			Credentials: &repositoryv1beta1.CredentialsSpec{
+				Type:          repositoryv1beta1.CredentialsTypeAccessToken,
+				TokenLifetime: &metav1.Duration{Duration: 3 * time.Hour},
+			},
+		},
+	}
+	defaultSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test-namespace"}}
+	builderSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "test-namespace"}}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	cl := fake.NewFakeClientWithScheme(s, repository, defaultSA, builderSA)
+	a := mockRepositoryClient{}
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &a, ResyncInterval: 10 * time.Hour, RegistryHosts: []string{"artifactory"}}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+	result, err := r.Reconcile(req)
+	if err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if a.usersCreated != 0 || a.tokensCreated != 1 {
+		t.Errorf("created %d users and %d tokens, want a single token", a.usersCreated, a.tokensCreated)
+	}
+	if !reflect.DeepEqual(a.permissionGroups, []string{"test-repository-repo-group"}) {
+		t.Errorf("permission groups = %v, want the group of the tokens", a.permissionGroups)
+	}
+	// The token is renewed after two hours, before the resync
+	if result.RequeueAfter > 2*time.Hour || result.RequeueAfter < 2*time.Hour-time.Minute {
+		t.Errorf("Reconcile() requeue after %v, want the renewal of the token", result.RequeueAfter)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, repository); err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if repository.Status.TokenExpiry == nil {
+		t.Fatalf("tokenExpiry is not set")
+	}
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "test-repository-repo-docker-secret", Namespace: "test-namespace"}, secret); err != nil {
+		t.Fatalf("get secret: (%v)", err)
+	}
+	config := DockerConfigJSON{}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		t.Fatalf("secret is not a docker config: (%v)", err)
+	}
+	if entry := config.Auths["artifactory"]; entry.Auth != encodeDockerConfigFieldAuth("test-repository-repo-user", "token-1") {
+		t.Errorf("docker config = %+v, want the access token", config)
+	}
+
+	// An expiring token is renewed
+	repository.Status.TokenExpiry = &metav1.Time{Time: time.Now().Add(30 * time.Minute)}
+	if err := cl.Status().Update(context.TODO(), repository); err != nil {
+		t.Fatalf("update repository status: (%v)", err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if a.tokensCreated != 2 {
+		t.Errorf("created %d tokens, want the expiring token to be renewed", a.tokensCreated)
+	}
+}
+
+func Test_SwitchToAccessTokenDeletesUser(t *testing.T) {
+	repository := &repositoryv1beta1.Repository{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "repository.storage.sebshift.io/v1beta1",
+			Kind:       "Repository",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-repository",
+			Namespace:  "test-namespace",
+			Finalizers: []string{finalizer},
+		},
+		Spec: repositoryv1beta1.RepositorySpec{
+			Repotype: "docker",
+		},
+	}
+	defaultSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "test-namespace"}}
+	builderSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "builder", Namespace: "test-namespace"}}
+
+	s := scheme.Scheme
+	s.AddKnownTypes(repositoryv1beta1.GroupVersion, repository)
+	cl := fake.NewFakeClientWithScheme(s, repository, defaultSA, builderSA)
+	a := mockRepositoryClient{}
+	r := &RepositoryReconciler{Client: cl, Log: ctrl.Log.WithName("test"), Scheme: s, rtc: &a, ResyncInterval: 10 * time.Hour, RegistryHosts: []string{"artifactory"}}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-repository", Namespace: "test-namespace"}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	if a.usersCreated != 1 || a.usersDeleted != 0 {
+		t.Fatalf("created %d and deleted %d users, want the repository user", a.usersCreated, a.usersDeleted)
+	}
+
+	// A lifetime of 0s, which the webhook rejects, gets the minimum lifetime instead of a token which never expires
+	if err := cl.Get(context.TODO(), req.NamespacedName, repository); err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	repository.Spec.Credentials = &repositoryv1beta1.CredentialsSpec{Type: repositoryv1beta1.CredentialsTypeAccessToken, TokenLifetime: &metav1.Duration{}}
+	if err := cl.Update(context.TODO(), repository); err != nil {
+		t.Fatalf("update repository: (%v)", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(req); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	if a.tokensCreated != 1 || a.usersDeleted != 1 {
+		t.Errorf("created %d tokens and deleted %d users, want the user replaced by a single token", a.tokensCreated, a.usersDeleted)
+	}
+	if err := cl.Get(context.TODO(), req.NamespacedName, repository); err != nil {
+		t.Fatalf("get repository: (%v)", err)
+	}
+	if expiry := repository.Status.TokenExpiry; expiry == nil || time.Until(expiry.Time) < repositoryv1beta1.MinTokenLifetime-time.Minute {
+		t.Errorf("tokenExpiry = %v, want the minimum lifetime", expiry)
+	}
+}
@@ -4,9 +4,13 @@ go 1.13
 
 require (
 	github.com/go-logr/logr v0.1.0
+	github.com/prometheus/client_golang v1.0.0
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/net v0.0.0-20190812203447-cdfb69ac37fc
+	golang.org/x/time v0.0.0-20180412165947-fbb02b2291d2
 	k8s.io/api v0.0.0-20190918195907-bd6ac527cfd2
 	k8s.io/apimachinery v0.0.0-20190817020851-f2f3a405f61d
 	k8s.io/client-go v0.0.0-20190918200256-06eb1244587a
 	sigs.k8s.io/controller-runtime v0.3.0
+	sigs.k8s.io/yaml v1.1.0
 )
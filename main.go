@@ -17,11 +17,19 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	configv1alpha1 "github.com/sebgroup/repo-operator/api/config/v1alpha1"
 	repositoryv1beta1 "github.com/sebgroup/repo-operator/api/v1beta1"
 	"github.com/sebgroup/repo-operator/controllers"
+	"github.com/sebgroup/repo-operator/pkg/repository"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -42,17 +50,83 @@ func init() {
 }
 
 func main() {
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
+	var resyncInterval time.Duration
+	var correctDrift bool
+	var enableWebhooks bool
+	var reconcileTimeout time.Duration
+	var maxConcurrentReconciles int
+	var maxConcurrentReconcilesPerNamespace int
+	var requeueBaseDelay time.Duration
+	var requeueMaxDelay time.Duration
+	var credentialsSecret string
+	var debugNamespaces string
+	flag.StringVar(&configFile, "config", "",
+		"Path of the operator config file. Flags given on the command line take precedence over the settings in the file.")
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&resyncInterval, "resync-interval", 10*time.Minute,
+		"How often every Repository is reconciled to detect drift in Artifactory. Zero disables the periodic resync.")
+	flag.BoolVar(&correctDrift, "correct-drift", false,
+		"Re-apply the desired Artifactory configuration when drift is detected instead of only reporting it.")
+	flag.DurationVar(&reconcileTimeout, "reconcile-timeout", 2*time.Minute,
+		"Deadline for a single reconcile including all its Artifactory requests. Zero disables the deadline.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", controllers.DefaultMaxConcurrentReconciles,
+		"Number of Repositories reconciled at the same time.")
+	flag.IntVar(&maxConcurrentReconcilesPerNamespace, "max-concurrent-reconciles-per-namespace", controllers.DefaultMaxConcurrentReconcilesPerNamespace,
+		"Number of workers the Repositories of a single namespace may use at the same time. Zero disables the limit.")
+	flag.DurationVar(&requeueBaseDelay, "requeue-base-delay", controllers.DefaultRequeueBaseDelay,
+		"Delay before a failed Repository is reconciled again, doubled on every further failure.")
+	flag.DurationVar(&requeueMaxDelay, "requeue-max-delay", controllers.DefaultRequeueMaxDelay,
+		"Longest delay before a failing Repository is reconciled again.")
+	flag.StringVar(&credentialsSecret, "credentials-secret", "",
+		"Namespace and name of the secret with the url, credentials and CA bundle of Artifactory, e.g. repo-operator/repo-operator-repo-secret. "+
+			"The secret is watched and the client is replaced when it changes.")
+	flag.StringVar(&debugNamespaces, "debug-namespaces", "",
+		"Comma separated namespaces whose Artifactory requests are logged with redacted credentials.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", true,
+		"Serve the validating webhook for Repository. Disable when running outside the cluster without serving certificates.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(func(o *zap.Options) {
 		o.Development = true
 	}))
 
+	operatorConfig := &configv1alpha1.OperatorConfig{}
+	if configFile != "" {
+		var err error
+		operatorConfig, err = configv1alpha1.Load(configFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load the operator config")
+			os.Exit(1)
+		}
+		if err = setFlagsFromConfig(operatorConfig); err != nil {
+			setupLog.Error(err, "unable to apply the operator config")
+			os.Exit(1)
+		}
+	}
+	clientConfig := repository.DefaultClientConfig()
+	if err := clientConfig.ApplyEnvironment(); err != nil {
+		setupLog.Error(err, "invalid Artifactory environment variables")
+		os.Exit(1)
+	}
+	if err := applyBackendConfig(operatorConfig, clientConfig); err != nil {
+		setupLog.Error(err, "unable to apply the operator config")
+		os.Exit(1)
+	}
+	if err := clientConfig.PasswordPolicy.Validate(); err != nil {
+		setupLog.Error(err, "invalid password policy")
+		os.Exit(1)
+	}
+	credentialsSecretKey, err := parseSecretReference(credentialsSecret)
+	if err != nil {
+		setupLog.Error(err, "invalid --credentials-secret")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
@@ -65,13 +139,35 @@ func main() {
 	}
 
 	if err = (&controllers.RepositoryReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Repository"),
-		Scheme: mgr.GetScheme(),
+		Client:                              mgr.GetClient(),
+		Log:                                 ctrl.Log.WithName("controllers").WithName("Repository"),
+		Scheme:                              mgr.GetScheme(),
+		Recorder:                            mgr.GetEventRecorderFor("repository-controller"),
+		ResyncInterval:                      resyncInterval,
+		CorrectDrift:                        correctDrift,
+		ReconcileTimeout:                    reconcileTimeout,
+		MaxConcurrentReconciles:             maxConcurrentReconciles,
+		MaxConcurrentReconcilesPerNamespace: maxConcurrentReconcilesPerNamespace,
+		RequeueBaseDelay:                    requeueBaseDelay,
+		RequeueMaxDelay:                     requeueMaxDelay,
+		ClientConfig:                        clientConfig,
+		SecretName:                          operatorConfig.Naming.Secret,
+		ImagePullServiceAccount:             operatorConfig.ServiceAccounts.ImagePull,
+		BuilderServiceAccount:               operatorConfig.ServiceAccounts.Builder,
+		DockerAccessMethod:                  operatorConfig.DockerRegistry.AccessMethod,
+		RegistryHosts:                       operatorConfig.DockerRegistry.Hosts,
+		CredentialsSecret:                   credentialsSecretKey,
+		DebugNamespaces:                     splitList(debugNamespaces),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Repository")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		if err = (&repositoryv1beta1.Repository{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Repository")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -80,3 +176,142 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// Set the flags which weren't given on the command line to the values in the operator config
+func setFlagsFromConfig(config *configv1alpha1.OperatorConfig) error {
+	values := map[string]string{}
+	if s := config.Backend.CredentialsSecret; s != nil {
+		values["credentials-secret"] = s.Namespace + "/" + s.Name
+	}
+	if len(config.Backend.DebugNamespaces) > 0 {
+		values["debug-namespaces"] = strings.Join(config.Backend.DebugNamespaces, ",")
+	}
+	c := config.Controller
+	if c.ResyncInterval != nil {
+		values["resync-interval"] = c.ResyncInterval.Duration.String()
+	}
+	if c.CorrectDrift != nil {
+		values["correct-drift"] = strconv.FormatBool(*c.CorrectDrift)
+	}
+	if c.ReconcileTimeout != nil {
+		values["reconcile-timeout"] = c.ReconcileTimeout.Duration.String()
+	}
+	if c.MaxConcurrentReconciles != nil {
+		values["max-concurrent-reconciles"] = strconv.Itoa(*c.MaxConcurrentReconciles)
+	}
+	if c.MaxConcurrentReconcilesPerNamespace != nil {
+		values["max-concurrent-reconciles-per-namespace"] = strconv.Itoa(*c.MaxConcurrentReconcilesPerNamespace)
+	}
+	if c.RequeueBaseDelay != nil {
+		values["requeue-base-delay"] = c.RequeueBaseDelay.Duration.String()
+	}
+	if c.RequeueMaxDelay != nil {
+		values["requeue-max-delay"] = c.RequeueMaxDelay.Duration.String()
+	}
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range values {
+		if given[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse a secret reference of the form namespace/name, an empty reference is no secret
+func parseSecretReference(ref string) (types.NamespacedName, error) {
+	if ref == "" {
+		return types.NamespacedName{}, nil
+	}
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("secret %q must be given as namespace/name", ref)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// The password policy of the operator config on top of the default policy
+func passwordPolicy(c configv1alpha1.PasswordPolicyConfig) repository.PasswordPolicy {
+	p := repository.DefaultPasswordPolicy
+	for _, setting := range []struct {
+		value  *int
+		target *int
+	}{{c.Length, &p.Length}, {c.MinUpper, &p.MinUpper}, {c.MinLower, &p.MinLower}, {c.MinDigits, &p.MinDigits}, {c.MinSpecial, &p.MinSpecial}} {
+		if setting.value != nil {
+			*setting.target = *setting.value
+		}
+	}
+	p.Specials = c.Specials
+	p.Exclude = c.Exclude
+	return p
+}
+
+// Split a comma separated flag, an empty flag is an empty list
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Apply the backend, naming and repository settings of the operator config on top of the environment variables
+func applyBackendConfig(c *configv1alpha1.OperatorConfig, conf *repository.ClientConfig) error {
+	b := c.Backend
+	if b.URL != "" {
+		conf.BaseURL = b.URL
+	}
+	if b.RequestTimeout != nil {
+		conf.Timeout = b.RequestTimeout.Duration
+	}
+	if b.MaxRetries != nil {
+		conf.MaxRetries = *b.MaxRetries
+	}
+	if b.RateLimit != nil {
+		conf.RateLimit = float64(*b.RateLimit)
+	}
+	if b.RateBurst != nil {
+		conf.RateBurst = *b.RateBurst
+	}
+	conf.Debug = conf.Debug || b.Debug
+	conf.VerifySSL = conf.VerifySSL || b.TLS.VerifySSL
+	if b.TLS.MinVersion != "" {
+		v, err := repository.ParseTLSVersion(b.TLS.MinVersion)
+		if err != nil {
+			return err
+		}
+		conf.MinTLSVersion = v
+	}
+	var err error
+	if b.TLS.CAFile != "" {
+		if conf.CACert, err = ioutil.ReadFile(b.TLS.CAFile); err != nil {
+			return err
+		}
+	}
+	if b.TLS.CertFile != "" {
+		if conf.ClientCert, err = ioutil.ReadFile(b.TLS.CertFile); err != nil {
+			return err
+		}
+		if conf.ClientKey, err = ioutil.ReadFile(b.TLS.KeyFile); err != nil {
+			return err
+		}
+	}
+	if b.Proxy.URL != "" {
+		conf.ProxyURL = b.Proxy.URL
+	}
+	if b.Proxy.NoProxy != "" {
+		conf.NoProxy = b.Proxy.NoProxy
+	}
+	conf.Naming = repository.Naming{User: c.Naming.User, PermissionTarget: c.Naming.PermissionTarget, Group: c.Naming.Group}
+	conf.PasswordPolicy = passwordPolicy(c.PasswordPolicy)
+	conf.RepositoryDefaults = map[string]repository.RepositoryDefaults{}
+	for repotype, defaults := range c.RepositoryDefaults {
+		conf.RepositoryDefaults[repotype] = repository.RepositoryDefaults{LayoutRef: defaults.LayoutRef, XrayIndex: defaults.XrayIndex}
+	}
+	return nil
+}
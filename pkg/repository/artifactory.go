@@ -1,17 +1,18 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"github.com/go-logr/logr"
 	"reflect"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var log = logf.Log.WithName("controller_repository")
-var Code int
-var Status string
 
 const (
 	ins                             = "instance.Namespace"
@@ -27,79 +28,84 @@ const (
 	suffixPackageClassLocal         = "-local"
 	suffixArtifactoryRepoUser       = "-repo-user"
 	suffixArtifactoryRepoPermission = "-repo-permission"
+	suffixArtifactoryRepoGroup      = "-repo-group"
 	snapshotSuffix                  = "-snapshot"
 	releaseSuffix                   = "-release"
 	statusInternalServerErrorState  = "Internal Server Error"
-	errorFailedToDeleteRepo         = "failed to delete repo "
+	errorFailedToDelete             = "failed to delete "
 	namespaceInhouseLibraries       = " namespace in-house libraries"
 	localRepositoryFor              = "Local repository for "
+	managedByNotes                  = "Managed by repo-operator for namespace "
 )
 
-func init() {
-	Code = okStateCode
-	Status = statusOKState
-}
-
 type RTFactory struct {
 	rtInterface
 }
 
 type rtInterface interface {
-	GetLocalRepo(c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error)
-	GetVirtualRepo(c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error)
-	GetRemoteRepos(c *Client, packageType string) ([]RemoteRepo, int, string, error)
-	CreateRepo(c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error)
-	DeleteRepo(c *Client, key string) (int, string, error)
-	GetUser(c *Client, key string, q map[string]string) (RepositoryUser, int, string, error)
-	CreateUser(c *Client, key string, u UserDetails, q map[string]string) (int, string, error)
-	DeleteUser(c *Client, key string) (int, string, error)
-	GetPermissionTargetDetails(c *Client, key string, q map[string]string) (PermissionTargetDetails, int, string, error)
-	CreatePermissionTarget(c *Client, key string, p PermissionTargetDetails, q map[string]string) (int, string, error)
-	DeletePermissionTarget(c *Client, key string) (int, string, error)
+	GetLocalRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error)
+	GetVirtualRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error)
+	GetRemoteRepos(ctx context.Context, c *Client, packageType string) ([]RemoteRepo, int, string, error)
+	CreateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error)
+	UpdateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error)
+	DeleteRepo(ctx context.Context, c *Client, key string) (int, string, error)
+	GetUser(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryUser, int, string, error)
+	CreateUser(ctx context.Context, c *Client, key string, u UserDetails, q map[string]string) (int, string, error)
+	UpdateUser(ctx context.Context, c *Client, key string, u UserDetails, q map[string]string) (int, string, error)
+	DeleteUser(ctx context.Context, c *Client, key string) (int, string, error)
+	GetPermissionTargetDetails(ctx context.Context, c *Client, key string, q map[string]string) (PermissionTargetDetails, int, string, error)
+	CreatePermissionTarget(ctx context.Context, c *Client, key string, p PermissionTargetDetails, q map[string]string) (int, string, error)
+	DeletePermissionTarget(ctx context.Context, c *Client, key string) (int, string, error)
+	CreateGroup(ctx context.Context, c *Client, key string, g GroupDetails, q map[string]string) (int, string, error)
+	DeleteGroup(ctx context.Context, c *Client, key string) (int, string, error)
+	CreateToken(ctx context.Context, c *Client, username string, scope string, expiresIn time.Duration) (tokenResponse, int, string, error)
 }
 
-// CreateRepositories : Function creates all the required repositories
-func (c *Client) CreateRepositories(repoName string, repoType string, namespace string, statusCode int) (int, string, error) {
-	var repoLocal RepositoryConfig
-	var repoVirtual RepositoryConfig
-	var remoteRepos []RemoteRepo
-
-	localRepoExist, codeLocal, statusLocal, err := c.createLocalRepository(repoLocal, repoName, repoType, namespace)
+// CreateRepositories : Function creates all the required repositories.
+// Repositories which already exist are reported as a conflict, unless adopt is set and they match the desired type and layout.
+func (c *Client) CreateRepositories(ctx context.Context, repoName string, repoType string, namespace string, statusCode int, adopt bool, recorder EventRecorder) (int, string, error) {
+	localRepoExist, codeLocal, statusLocal, err := c.createLocalRepository(ctx, repoName, repoType, namespace, adopt, recorder)
 	if err != nil {
 		return codeLocal, statusLocal, err
 	}
 
-	virtualRepoExist, codeVirtual, statusVirtual, err := c.createVirtualRepository(repoVirtual, repoName, remoteRepos, repoType, namespace)
+	virtualRepoExist, codeVirtual, statusVirtual, err := c.createVirtualRepository(ctx, repoName, repoType, namespace, adopt, recorder)
 	if err != nil {
 		return codeVirtual, statusVirtual, err
 	}
 
 	// Check if repo already exist with the name and use don't accidentally modify some other repo
-	if localRepoExist && virtualRepoExist && statusCode != 200 {
+	if localRepoExist && virtualRepoExist && statusCode != 200 && !adopt {
 		return conflictStateCode, conflictState, nil
 	}
 	return okStateCode, statusOKState, nil
 }
 
 // CreateRepositories : Function creates virtual repositories
-func (c *Client) createVirtualRepository(repoVirtual RepositoryConfig, repoName string, remoteRepos []RemoteRepo, repoType string, namespace string) (bool, int, string, error) {
+func (c *Client) createVirtualRepository(ctx context.Context, repoName string, repoType string, namespace string, adopt bool, recorder EventRecorder) (bool, int, string, error) {
 	// Check if Virtual Repository already exists in Artifactory
 	virtualRepoExist := false
 	reqLogger := log.WithValues(ins, namespace, rname, repoName)
-	repoVirtual, Code, Status, err := c.rt.GetVirtualRepo(c, repoName, make(map[string]string))
-	if err != nil {
-		return false, Code, Status, err
+	repoVirtual, code, status, err := c.rt.GetVirtualRepo(ctx, c, repoName, make(map[string]string))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, code, status, err
 	}
-	if repoVirtual.(VirtualRepoConfig).Key == repoName {
+	if err == nil && repoVirtual.(VirtualRepoConfig).Key == repoName {
 		// Repository already exists - don't requeue
 		reqLogger.Info("Skip reconcile: If repo already exists " + repoVirtual.(VirtualRepoConfig).Key)
 		virtualRepoExist = true
+		if adopt {
+			code, status, err = c.adoptRepository(ctx, repoVirtual.(VirtualRepoConfig).GenericRepoConfig, getVirtualRepoConfig(nil, repoName, repoType, namespace, artifactoryClassVirtual).GenericRepoConfig, reqLogger, recorder)
+			if err != nil {
+				return false, code, status, err
+			}
+		}
 	}
 	if !virtualRepoExist {
 		// Get all the remote repositories for particular type.
-		remoteRepos, Code, Status, err = c.rt.GetRemoteRepos(c, repoType)
+		remoteRepos, code, status, err := c.rt.GetRemoteRepos(ctx, c, repoType)
 		if err != nil {
-			return false, Code, Status, err
+			return false, code, status, err
 		}
 		repositories := []string{}
 		for _, repos := range remoteRepos {
@@ -108,108 +114,314 @@ func (c *Client) createVirtualRepository(repoVirtual RepositoryConfig, repoName
 
 		reqLogger.Info("Creating virtual repository...." + repoName)
 		// Create repository if it doesn't exist
-		Code, Status, err = c.rt.CreateRepo(c, repoName, getVirtualRepoConfig(repositories, repoName, repoType, namespace, artifactoryClassVirtual), make(map[string]string))
+		virtualConfig := getVirtualRepoConfig(repositories, repoName, repoType, namespace, artifactoryClassVirtual)
+		code, status, err = c.rt.CreateRepo(ctx, c, repoName, virtualConfig, make(map[string]string))
 		if err != nil {
-			return false, Code, Status, err
+			return false, code, status, err
 		}
+		recordEvent(recorder, EventReasonVirtualRepositoryCreated, "Created virtual repository %s aggregating %s", repoName, strings.Join(virtualConfig.Repositories, ", "))
 	}
 	return virtualRepoExist, 0, "", nil
 }
 
 // CreateRepositories : Function creates Local repositories
-func (c *Client) createLocalRepository(repoLocal RepositoryConfig, repoName string, repoType string, namespace string) (bool, int, string, error) {
+func (c *Client) createLocalRepository(ctx context.Context, repoName string, repoType string, namespace string, adopt bool, recorder EventRecorder) (bool, int, string, error) {
 	// Check if local Repository already exists in Artifactory
 	localRepoExist := false
 	reqLogger := log.WithValues(ins, namespace, rname, repoName)
-	repoLocal, Code, Status, err := c.rt.GetLocalRepo(c, repoName+suffixPackageClassLocal, make(map[string]string))
-	if err != nil {
-		return false, Code, Status, nil
+	repoLocal, code, status, err := c.rt.GetLocalRepo(ctx, c, repoName+suffixPackageClassLocal, make(map[string]string))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, code, status, err
 	}
-	if repoLocal.(LocalRepoConfig).Key == repoName+suffixPackageClassLocal {
+	if err == nil && repoLocal.(LocalRepoConfig).Key == repoName+suffixPackageClassLocal {
 		// Repository already exists - don't requeue
 		reqLogger.Info("Skip reconcile: If repo already exists " + repoLocal.(LocalRepoConfig).Key)
 		localRepoExist = true
+		if adopt {
+			code, status, err = c.adoptRepository(ctx, repoLocal.(LocalRepoConfig).GenericRepoConfig, c.localRepoConfig(repoName, repoType, namespace).GenericRepoConfig, reqLogger, recorder)
+			if err != nil {
+				return false, code, status, err
+			}
+		}
 	}
 	if !localRepoExist {
 		reqLogger.Info("Creating local repository...." + repoName + suffixPackageClassLocal)
 		// Create repository if it doesn't exist
-		Code, Status, err = c.rt.CreateRepo(c, repoName+suffixPackageClassLocal, getLocalRepoConfig(repoName, repoType, namespace, artifactoryClassLocal), make(map[string]string))
+		code, status, err = c.rt.CreateRepo(ctx, c, repoName+suffixPackageClassLocal, c.localRepoConfig(repoName, repoType, namespace), make(map[string]string))
 		if err != nil {
-			return false, Code, Status, err
+			return false, code, status, err
 		}
+		recordEvent(recorder, EventReasonRepositoryCreated, "Created local repository %s", repoName+suffixPackageClassLocal)
 	}
 	return localRepoExist, 0, "", nil
 }
 
-// CreateRepositoryUser : Create repository user
-func (c *Client) CreateRepositoryUser(reqName string) (string, int, string, error) {
+// Adopt an existing repository: its package type (and layout for local repositories) must match the desired config
+// and it must not be managed for another namespace. The repository is tagged as managed through its notes.
+func (c *Client) adoptRepository(ctx context.Context, existing GenericRepoConfig, desired GenericRepoConfig, reqLogger logr.Logger, recorder EventRecorder) (int, string, error) {
+	if !strings.EqualFold(existing.PackageType, desired.PackageType) {
+		return conflictStateCode, conflictState, &AdoptionError{Key: existing.Key, Reason: "package type " + existing.PackageType + " does not match " + desired.PackageType}
+	}
+	if desired.RClass == artifactoryClassLocal && existing.LayoutRef != desired.LayoutRef {
+		return conflictStateCode, conflictState, &AdoptionError{Key: existing.Key, Reason: "layout " + existing.LayoutRef + " does not match " + desired.LayoutRef}
+	}
+	if strings.HasPrefix(existing.Notes, desired.Notes) {
+		// Already managed by this namespace
+		return okStateCode, statusOKState, nil
+	}
+	if strings.HasPrefix(existing.Notes, managedByNotes) {
+		return conflictStateCode, conflictState, &AdoptionError{Key: existing.Key, Reason: "it is managed for another namespace"}
+	}
+	notes := desired.Notes
+	if existing.Notes != "" {
+		notes = notes + "\n" + existing.Notes
+	}
+	reqLogger.Info("Adopting existing repository " + existing.Key)
+	code, status, err := c.rt.UpdateRepo(ctx, c, existing.Key, GenericRepoConfig{Key: existing.Key, RClass: desired.RClass, Notes: notes}, make(map[string]string))
+	if err == nil {
+		recordEvent(recorder, EventReasonRepositoryAdopted, "Adopted existing repository %s", existing.Key)
+	}
+	return code, status, err
+}
+
+// Notes marking a repository as managed by the operator for a namespace
+func managedNotes(namespace string) string {
+	return managedByNotes + namespace + "."
+}
+
+// CheckDrift : Compare the settings managed by the operator on the live local and virtual repositories with the
+// desired config. The drifted settings are returned, and re-applied when correct is set.
+func (c *Client) CheckDrift(ctx context.Context, repoName string, repoType string, namespace string, correct bool) ([]string, error) {
+	reqLogger := log.WithValues(ins, namespace, rname, repoName)
+	drifted := []string{}
+
+	live, _, _, err := c.rt.GetLocalRepo(ctx, c, repoName+suffixPackageClassLocal, make(map[string]string))
+	if err != nil {
+		return nil, err
+	}
+	desiredLocal := c.localRepoConfig(repoName, repoType, namespace)
+	localDrift := localRepoDrift(live.(LocalRepoConfig), desiredLocal)
+	if len(localDrift) > 0 && correct {
+		reqLogger.Info("Correcting drifted local repository " + desiredLocal.Key)
+		patch := localRepoPatch{
+			Key:             desiredLocal.Key,
+			RClass:          desiredLocal.RClass,
+			HandleReleases:  desiredLocal.HandleReleases,
+			HandleSnapshots: desiredLocal.HandleSnapshots,
+			XrayIndex:       desiredLocal.XrayIndex,
+		}
+		if _, _, err := c.rt.UpdateRepo(ctx, c, desiredLocal.Key, patch, make(map[string]string)); err != nil {
+			return nil, err
+		}
+	}
+	drifted = append(drifted, localDrift...)
+
+	live, _, _, err = c.rt.GetVirtualRepo(ctx, c, repoName, make(map[string]string))
+	if err != nil {
+		return nil, err
+	}
+	remoteRepos, _, _, err := c.rt.GetRemoteRepos(ctx, c, repoType)
+	if err != nil {
+		return nil, err
+	}
+	repositories := []string{}
+	for _, repos := range remoteRepos {
+		repositories = append(repositories, repos.Key)
+	}
+	desiredVirtual := getVirtualRepoConfig(repositories, repoName, repoType, namespace, artifactoryClassVirtual)
+	virtualDrift := virtualRepoDrift(live.(VirtualRepoConfig), desiredVirtual)
+	if len(virtualDrift) > 0 && correct {
+		reqLogger.Info("Correcting drifted virtual repository " + desiredVirtual.Key)
+		patch := VirtualRepoConfig{
+			GenericRepoConfig: GenericRepoConfig{
+				Key:    desiredVirtual.Key,
+				RClass: desiredVirtual.RClass,
+			},
+			Repositories:          desiredVirtual.Repositories,
+			DefaultDeploymentRepo: desiredVirtual.DefaultDeploymentRepo,
+		}
+		if _, _, err := c.rt.UpdateRepo(ctx, c, desiredVirtual.Key, patch, make(map[string]string)); err != nil {
+			return nil, err
+		}
+	}
+	drifted = append(drifted, virtualDrift...)
+	return drifted, nil
+}
+
+// Settings of a local repository which differ from the desired config
+func localRepoDrift(live LocalRepoConfig, desired LocalRepoConfig) []string {
+	drifted := []string{}
+	if live.XrayIndex != desired.XrayIndex {
+		drifted = append(drifted, desired.Key+": xrayIndex")
+	}
+	if desired.HandleReleases != nil && (live.HandleReleases == nil || *live.HandleReleases != *desired.HandleReleases) {
+		drifted = append(drifted, desired.Key+": handleReleases")
+	}
+	if desired.HandleSnapshots != nil && (live.HandleSnapshots == nil || *live.HandleSnapshots != *desired.HandleSnapshots) {
+		drifted = append(drifted, desired.Key+": handleSnapshots")
+	}
+	return drifted
+}
+
+// Settings of a virtual repository which differ from the desired config
+func virtualRepoDrift(live VirtualRepoConfig, desired VirtualRepoConfig) []string {
+	drifted := []string{}
+	liveRepos := append([]string{}, live.Repositories...)
+	desiredRepos := append([]string{}, desired.Repositories...)
+	//sort before compare
+	sort.Strings(liveRepos)
+	sort.Strings(desiredRepos)
+	if !reflect.DeepEqual(liveRepos, desiredRepos) {
+		drifted = append(drifted, desired.Key+": repositories")
+	}
+	if live.DefaultDeploymentRepo != desired.DefaultDeploymentRepo {
+		drifted = append(drifted, desired.Key+": defaultDeploymentRepo")
+	}
+	return drifted
+}
+
+// CreateRepositoryUser : Create repository user with a new password, or reset the password when the user exists,
+// e.g. after the secret with the previous password was lost
+func (c *Client) CreateRepositoryUser(ctx context.Context, reqName string) (string, int, string, error) {
 	// Generate random password
-	rp := GenerateRandomPassword()
+	rp, err := c.passwordPolicy().Generate()
+	if err != nil {
+		return "", 0, "", err
+	}
+	userName := c.naming().UserName(reqName)
 	userDetails := UserDetails{
-		Name:                     reqName + suffixArtifactoryRepoUser,
-		Email:                    reqName + suffixArtifactoryRepoUser + "@internal.com",
+		Name:                     userName,
+		Email:                    userName + "@internal.com",
 		Password:                 rp,
 		DisableUIAccess:          true,
 		ProfileUpdatable:         false,
 		InternalPasswordDisabled: false,
 		Realm:                    "Internal",
 	}
-	cd, s, err := c.rt.CreateUser(c, reqName+suffixArtifactoryRepoUser, userDetails, make(map[string]string))
+	_, cd, s, err := c.rt.GetUser(ctx, c, userName, make(map[string]string))
+	switch {
+	case err == nil:
+		cd, s, err = c.rt.UpdateUser(ctx, c, userName, userDetails, make(map[string]string))
+	case errors.Is(err, ErrNotFound):
+		cd, s, err = c.rt.CreateUser(ctx, c, userName, userDetails, make(map[string]string))
+	}
 	return rp, cd, s, err
 }
 
-// CreatePermission : Create permission object
-func (c *Client) CreatePermission(reqName string, repoType string, namespace string, users []string, repositories []string) error {
+// DeleteRepositoryUser : Delete the repository user, e.g. when its password was replaced by access tokens.
+// A user which doesn't exist is not an error.
+func (c *Client) DeleteRepositoryUser(ctx context.Context, reqName string) error {
+	_, _, err := c.rt.DeleteUser(ctx, c, c.naming().UserName(reqName))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// RepositoryToken is an access token which grants the permissions of the group of a repository
+type RepositoryToken struct {
+	// Username is the subject of the token, there is no such user in Artifactory
+	Username string
+	Token    string
+	// Expiry is when the token stops being accepted
+	Expiry time.Time
+}
+
+// CreateRepositoryToken : Create an access token scoped to the group of a repository, which expires after expiresIn.
+// The group is created when it doesn't exist yet; the permission target grants the repositories to it.
+func (c *Client) CreateRepositoryToken(ctx context.Context, reqName string, expiresIn time.Duration) (RepositoryToken, error) {
+	group := c.naming().GroupName(reqName)
+	groupDetails := GroupDetails{
+		Name:        group,
+		Description: "Access tokens of " + reqName + " created by repo-operator",
+		Realm:       "internal",
+	}
+	if _, _, err := c.rt.CreateGroup(ctx, c, group, groupDetails, make(map[string]string)); err != nil {
+		return RepositoryToken{}, err
+	}
+	username := c.naming().UserName(reqName)
+	res, _, _, err := c.rt.CreateToken(ctx, c, username, "member-of-groups:"+group, expiresIn)
+	if err != nil {
+		return RepositoryToken{}, err
+	}
+	if res.AccessToken == "" {
+		return RepositoryToken{}, errors.New("the access token response has no access token")
+	}
+	expiry := tokenExpiry(res.AccessToken)
+	if expiry.IsZero() {
+		expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return RepositoryToken{Username: username, Token: res.AccessToken, Expiry: expiry}, nil
+}
+
+// CreatePermission : Create permission object, the groups get the access tokens of the repository
+func (c *Client) CreatePermission(ctx context.Context, reqName string, repoType string, namespace string, users []string, groups []string, repositories []string, recorder EventRecorder) error {
 	reqLogger := log.WithValues(ins, namespace, rname, reqName)
+	permissionTarget := c.naming().PermissionTargetName(reqName, repoType)
 	// Create Permission target for User
-	reqLogger.Info("Create Permission target - "+reqName+"-"+repoType+suffixArtifactoryRepoPermission, "Namespace", namespace, "Name", reqName)
+	reqLogger.Info("Create Permission target - "+permissionTarget, "Namespace", namespace, "Name", reqName)
 	// create user list to be added for access
 
 	// Check if any user is Admin or remove user if not found
-	userList, err, empty := c.filerUserList(users, reqLogger)
-	if empty {
+	userList, err, empty := c.filerUserList(ctx, users, reqLogger)
+	if empty && len(groups) == 0 {
 		return err
 	}
+	if empty {
+		userList = []string{}
+	}
 
 	u := map[string][]string{}
 	for _, each := range userList {
 		u[each] = []string{"r", "d", "w", "n", "m"}
 	}
+	// Access tokens can push and pull, but not manage the repositories
+	g := map[string][]string{}
+	for _, each := range groups {
+		g[each] = []string{"r", "d", "w", "n"}
+	}
 	pt := PermissionTargetDetails{
-		Name:            reqName + "-" + repoType + suffixArtifactoryRepoPermission,
+		Name:            permissionTarget,
 		IncludesPattern: "**",
 		ExcludesPattern: "",
 		Repositories:    repositories,
 		Principals: Principals{
-			Users: u,
+			Users:  u,
+			Groups: g,
 		},
 	}
 	// Check if permission object already exists in Artifactory
-	ptd, _, _, err := c.rt.GetPermissionTargetDetails(c, reqName+"-"+repoType+suffixArtifactoryRepoPermission, make(map[string]string))
+	ptd, _, _, err := c.rt.GetPermissionTargetDetails(ctx, c, permissionTarget, make(map[string]string))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		reqLogger.Error(err, "failed to get permission target")
+		return err
+	}
 	if err != nil {
 		reqLogger.Info("Permission target does not exist - it will be created")
-		_, _, err := c.rt.CreatePermissionTarget(c, reqName+"-"+repoType+suffixArtifactoryRepoPermission, pt, make(map[string]string))
+		_, _, err := c.rt.CreatePermissionTarget(ctx, c, permissionTarget, pt, make(map[string]string))
 		if err != nil {
 			reqLogger.Error(err, "failed to create permission target")
+			recordWarning(recorder, EventReasonPermissionTargetFailed, "Failed to create permission target %s: %v", pt.Name, err)
 			return err
 		}
+		recordEvent(recorder, EventReasonPermissionTargetCreated, "Created permission target %s for users %s", pt.Name, strings.Join(userList, ", "))
 	} else {
 		reqLogger.Info("Permission target already exist check if there is any change in user...")
-		existingUserList := []string{}
-		for user := range ptd.Principals.Users {
-			existingUserList = append(existingUserList, user)
-		}
 		//sort Maps before compare
-		sort.Strings(existingUserList)
+		existingUserList := principalNames(ptd.Principals.Users)
 		sort.Strings(userList)
-		if !reflect.DeepEqual(existingUserList, userList) {
-			reqLogger.Info("Changes in the user list detected - update permission target")
+		usersChanged := !reflect.DeepEqual(existingUserList, userList)
+		groupsChanged := !reflect.DeepEqual(principalNames(ptd.Principals.Groups), principalNames(g))
+		if usersChanged || groupsChanged {
+			reqLogger.Info("Changes in the user or group list detected - update permission target")
 			// Create or replace the permission target; this  should even work for creation and deletion of users
-			_, _, err := c.rt.CreatePermissionTarget(c, reqName+"-"+repoType+suffixArtifactoryRepoPermission, pt, make(map[string]string))
+			_, _, err := c.rt.CreatePermissionTarget(ctx, c, permissionTarget, pt, make(map[string]string))
 			if err != nil {
 				reqLogger.Error(err, "failed to update permission target")
+				recordWarning(recorder, EventReasonPermissionTargetFailed, "Failed to update permission target %s: %v", pt.Name, err)
 				return err
 			}
+			recordEvent(recorder, EventReasonPermissionTargetUpdated, "Updated permission target %s for users %s", pt.Name, strings.Join(userList, ", "))
 		} else {
 			reqLogger.Info("No changes in user list - skip update")
 		}
@@ -217,11 +429,21 @@ func (c *Client) CreatePermission(reqName string, repoType string, namespace str
 	return nil
 }
 
+// Sorted names of the principals of a permission target
+func principalNames(principals map[string][]string) []string {
+	names := []string{}
+	for name := range principals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Filter
-func (c *Client) filerUserList(users []string, reqLogger logr.Logger) ([]string, error, bool) {
+func (c *Client) filerUserList(ctx context.Context, users []string, reqLogger logr.Logger) ([]string, error, bool) {
 	userList := []string{}
 	for _, user := range users {
-		userDetails, _, _, err := c.rt.GetUser(c, user, make(map[string]string))
+		userDetails, _, _, err := c.rt.GetUser(ctx, c, user, make(map[string]string))
 		if err != nil {
 			reqLogger.Error(err, "failed to get user - do not add to list")
 		}
@@ -236,92 +458,128 @@ func (c *Client) filerUserList(users []string, reqLogger logr.Logger) ([]string,
 	return userList, nil, false
 }
 
-// CleanupRepository : It clean-up everything related to repositories
-func (c *Client) CleanupRepository(reqName string, repoType string, namespace string) error {
+// CleanupRepository : It clean-up everything related to repositories.
+// Objects which are already gone count as deleted, everything else that fails is reported in a CleanupError.
+func (c *Client) CleanupRepository(ctx context.Context, reqName string, repoType string, namespace string) error {
 	reqLogger := log.WithValues(ins, namespace, rname, reqName)
-	switch repoType {
-	case mavenRepoType:
-		c.cleanUpMavenRepository(reqName, repoType, reqLogger)
-
-	case dockerRepoType:
-		c.cleanUpDockerRepository(reqName, repoType, reqLogger)
-
-	default:
-		c.cleanUpOtherRepository(reqName, repoType, reqLogger)
+	failed := map[string]error{}
+	c.deleteRepos(ctx, repositoryKeys(reqName, repoType), failed, reqLogger)
+	if repoType == dockerRepoType {
+		// Clean User
+		userName := c.naming().UserName(reqName)
+		code, _, err := c.rt.DeleteUser(ctx, c, userName)
+		recordCleanupResult(failed, userName, code, err, reqLogger)
+		// Clean the group of the access tokens, the tokens which haven't expired yet lose their permissions with it
+		group := c.naming().GroupName(reqName)
+		code, _, err = c.rt.DeleteGroup(ctx, c, group)
+		recordCleanupResult(failed, group, code, err, reqLogger)
 	}
 	// Clean Permission Target
-	_, _, err := c.rt.DeletePermissionTarget(c, reqName+"-"+repoType+suffixArtifactoryRepoPermission)
-	if err != nil {
-		reqLogger.Error(err, "failed to delete permission "+reqName+"-"+repoType+suffixArtifactoryRepoPermission)
-		//return err
+	permissionTarget := c.naming().PermissionTargetName(reqName, repoType)
+	code, _, err := c.rt.DeletePermissionTarget(ctx, c, permissionTarget)
+	recordCleanupResult(failed, permissionTarget, code, err, reqLogger)
+	if len(failed) > 0 {
+		return &CleanupError{Failed: failed}
 	}
 	return nil
 }
 
-// Cleanup Maven repository
-func (c *Client) cleanUpMavenRepository(reqName string, repoType string, reqLogger logr.Logger) {
-	// cleanup local snapshot repos
-	_, _, err := c.rt.DeleteRepo(c, reqName+"-"+repoType+snapshotSuffix+suffixPackageClassLocal)
-	if err != nil {
-		reqLogger.Error(err, errorFailedToDeleteRepo+reqName+"-"+repoType+snapshotSuffix+suffixPackageClassLocal)
-		//return err
+// ArchiveRepository : Black out the repositories and remove the permission target, the artifacts stay in Artifactory
+func (c *Client) ArchiveRepository(ctx context.Context, reqName string, repoType string, namespace string) error {
+	reqLogger := log.WithValues(ins, namespace, rname, reqName)
+	failed := map[string]error{}
+	for _, key := range repositoryKeys(reqName, repoType) {
+		rclass := artifactoryClassVirtual
+		if strings.HasSuffix(key, suffixPackageClassLocal) {
+			rclass = artifactoryClassLocal
+		}
+		reqLogger.Info("Black out repository " + key)
+		code, _, err := c.rt.UpdateRepo(ctx, c, key, GenericRepoConfig{Key: key, RClass: rclass, BlackedOut: true}, make(map[string]string))
+		recordCleanupResult(failed, key, code, err, reqLogger)
 	}
-	// cleanup virtual snapshot repos
-	_, _, err = c.rt.DeleteRepo(c, reqName+"-"+repoType+snapshotSuffix)
-	if err != nil {
-		reqLogger.Error(err, errorFailedToDeleteRepo+reqName+"-"+repoType+snapshotSuffix)
-		//return err
+	// Clean Permission Target
+	permissionTarget := c.naming().PermissionTargetName(reqName, repoType)
+	code, _, err := c.rt.DeletePermissionTarget(ctx, c, permissionTarget)
+	recordCleanupResult(failed, permissionTarget, code, err, reqLogger)
+	if len(failed) > 0 {
+		return &CleanupError{Failed: failed}
 	}
-	// cleanup local release repos
-	_, _, err = c.rt.DeleteRepo(c, reqName+"-"+repoType+releaseSuffix+suffixPackageClassLocal)
-	if err != nil {
-		reqLogger.Error(err, "failed to delete repo"+reqName+"-"+repoType+releaseSuffix+suffixPackageClassLocal)
-		//return err
+	return nil
+}
+
+// DeletePermission : Remove the permission target of a request, the repositories are left untouched
+func (c *Client) DeletePermission(ctx context.Context, reqName string, repoType string, namespace string) error {
+	reqLogger := log.WithValues(ins, namespace, rname, reqName)
+	failed := map[string]error{}
+	permissionTarget := c.naming().PermissionTargetName(reqName, repoType)
+	code, _, err := c.rt.DeletePermissionTarget(ctx, c, permissionTarget)
+	recordCleanupResult(failed, permissionTarget, code, err, reqLogger)
+	if len(failed) > 0 {
+		return &CleanupError{Failed: failed}
 	}
-	// cleanup virtual release repos
-	_, _, err = c.rt.DeleteRepo(c, reqName+"-"+repoType+releaseSuffix)
-	if err != nil {
-		reqLogger.Error(err, errorFailedToDeleteRepo+reqName+"-"+repoType+releaseSuffix)
-		//return err
+	return nil
+}
+
+// Keys of the local and virtual repositories created for a request
+func repositoryKeys(reqName string, repoType string) []string {
+	if repoType == mavenRepoType {
+		return []string{
+			reqName + "-" + repoType + snapshotSuffix + suffixPackageClassLocal,
+			reqName + "-" + repoType + snapshotSuffix,
+			reqName + "-" + repoType + releaseSuffix + suffixPackageClassLocal,
+			reqName + "-" + repoType + releaseSuffix,
+		}
 	}
+	return []string{reqName + "-" + repoType + suffixPackageClassLocal, reqName + "-" + repoType}
 }
 
-// Cleanup Docker repository
-func (c *Client) cleanUpDockerRepository(reqName string, repoType string, reqLogger logr.Logger) {
-	// cleanup local repos
-	_, _, err := c.rt.DeleteRepo(c, reqName+"-"+repoType+suffixPackageClassLocal)
-	if err != nil {
-		reqLogger.Error(err, errorFailedToDeleteRepo+reqName+"-"+repoType+suffixPackageClassLocal)
-		//return err
+// Delete the given repositories and record the ones that could not be deleted
+func (c *Client) deleteRepos(ctx context.Context, keys []string, failed map[string]error, reqLogger logr.Logger) {
+	for _, key := range keys {
+		code, _, err := c.rt.DeleteRepo(ctx, c, key)
+		recordCleanupResult(failed, key, code, err, reqLogger)
 	}
-	// cleanup virtual repos
-	_, _, err = c.rt.DeleteRepo(c, reqName+"-"+repoType)
-	if err != nil {
-		reqLogger.Error(err, errorFailedToDeleteRepo+reqName+"-"+repoType)
-		//return err
+}
+
+// Record a failed delete; an object that is not found is already cleaned up
+func recordCleanupResult(failed map[string]error, key string, code int, err error, reqLogger logr.Logger) {
+	if err == nil || errors.Is(err, ErrNotFound) {
+		return
 	}
-	// Clean User
-	_, _, err = c.rt.DeleteUser(c, reqName+suffixArtifactoryRepoUser)
-	if err != nil {
-		reqLogger.Error(err, "failed to delete user")
-		//return err
+	reqLogger.Error(err, errorFailedToDelete+key)
+	failed[key] = err
+}
+
+// Configuration of a local repository with the defaults configured for its repotype
+func (c *Client) localRepoConfig(repoName string, repoType string, namespace string) LocalRepoConfig {
+	rc := getLocalRepoConfig(repoName, repoType, namespace, artifactoryClassLocal)
+	if c.Config == nil {
+		return rc
+	}
+	if defaults, ok := c.Config.RepositoryDefaults[repoType]; ok {
+		if defaults.LayoutRef != "" {
+			rc.LayoutRef = defaults.LayoutRef
+		}
+		if defaults.XrayIndex != nil {
+			rc.XrayIndex = *defaults.XrayIndex
+		}
 	}
+	return rc
 }
 
-// CLeanup other repository
-func (c *Client) cleanUpOtherRepository(reqName string, repoType string, reqLogger logr.Logger) {
-	// cleanup local repos
-	_, _, err := c.rt.DeleteRepo(c, reqName+"-"+repoType+suffixPackageClassLocal)
-	if err != nil {
-		reqLogger.Error(err, errorFailedToDeleteRepo+reqName+"-"+repoType+suffixPackageClassLocal)
-		//return err
+// Naming templates of the client
+func (c *Client) passwordPolicy() PasswordPolicy {
+	if c.Config == nil {
+		return DefaultPasswordPolicy
 	}
-	// cleanup virtual repos
-	_, _, err = c.rt.DeleteRepo(c, reqName+"-"+repoType)
-	if err != nil {
-		reqLogger.Error(err, errorFailedToDeleteRepo+reqName+"-"+repoType)
-		//return err
+	return c.Config.PasswordPolicy
+}
+
+func (c *Client) naming() Naming {
+	if c.Config == nil {
+		return DefaultNaming
 	}
+	return c.Config.Naming
 }
 
 // Function to generate configuration for Local repositories.
@@ -343,6 +601,7 @@ func getLocalRepoConfig(repoName string, repoType string, namespace string, pack
 				RClass:          packageClass,
 				PackageType:     repoType,
 				Description:     localRepositoryFor + namespace + namespaceInhouseLibraries,
+				Notes:           managedNotes(namespace),
 				LayoutRef:       repoType + "-2-default",
 				HandleSnapshots: &snapshot,
 				HandleReleases:  &release,
@@ -357,6 +616,7 @@ func getLocalRepoConfig(repoName string, repoType string, namespace string, pack
 				RClass:      packageClass,
 				PackageType: repoType,
 				Description: localRepositoryFor + namespace + namespaceInhouseLibraries,
+				Notes:       managedNotes(namespace),
 				LayoutRef:   "simple-default",
 			},
 			XrayIndex: true,
@@ -370,6 +630,7 @@ func getLocalRepoConfig(repoName string, repoType string, namespace string, pack
 				RClass:      packageClass,
 				PackageType: repoType,
 				Description: localRepositoryFor + namespace + namespaceInhouseLibraries,
+				Notes:       managedNotes(namespace),
 				LayoutRef:   repoType + "-default",
 			},
 			XrayIndex: true,
@@ -389,6 +650,7 @@ func getVirtualRepoConfig(remoteRepositories []string, repoName string, repoType
 			LayoutRef:    "simple-default",
 			PropertySets: []string{"artifactory"},
 			Description:  "virtual repository for " + namespace + " namespace and required remote libraries",
+			Notes:        managedNotes(namespace),
 		},
 		Repositories:          repos,
 		DefaultDeploymentRepo: repoName + suffixPackageClassLocal,
@@ -1,8 +1,18 @@
 package repository
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestClient_CreateRepositories(t *testing.T) {
@@ -24,6 +34,7 @@ func TestClient_CreateRepositories(t *testing.T) {
 		repoType   string
 		namespace  string
 		statusCode int
+		adopt      bool
 	}
 	tests := []struct {
 		name    string
@@ -75,11 +86,15 @@ func TestClient_CreateRepositories(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, err := client.CreateRepositories(tt.args.repoName, tt.args.repoType, tt.args.namespace, tt.args.statusCode)
+			recorder := &recordingEventRecorder{}
+			got, got1, err := client.CreateRepositories(context.TODO(), tt.args.repoName, tt.args.repoType, tt.args.namespace, tt.args.statusCode, tt.args.adopt, recorder)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreateRepositories() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if want := []string{EventReasonRepositoryCreated, EventReasonVirtualRepositoryCreated}; !reflect.DeepEqual(recorder.reasons, want) {
+				t.Errorf("CreateRepositories() events = %v, want %v", recorder.reasons, want)
+			}
 			if got != tt.code {
 				t.Errorf("CreateRepositories() got = %v, want %v", got, tt.code)
 			}
@@ -90,9 +105,403 @@ func TestClient_CreateRepositories(t *testing.T) {
 	}
 }
 
+func TestClient_CreateRepositoriesAdoption(t *testing.T) {
+	tests := []struct {
+		name        string
+		adopt       bool
+		packageType string
+		layout      string
+		notes       string
+		code        int
+		wantErr     bool
+		wantUpdates int
+	}{
+		{
+			name:        "Test existing repositories are a conflict without adopt",
+			adopt:       false,
+			packageType: "npm",
+			layout:      "npm-default",
+			code:        conflictStateCode,
+		},
+		{
+			name:        "Test matching repositories are adopted and tagged",
+			adopt:       true,
+			packageType: "npm",
+			layout:      "npm-default",
+			notes:       "hand made",
+			code:        okStateCode,
+			wantUpdates: 2,
+		},
+		{
+			name:        "Test repositories already managed by the namespace are not tagged again",
+			adopt:       true,
+			packageType: "npm",
+			layout:      "npm-default",
+			notes:       managedNotes("test-namespace"),
+			code:        okStateCode,
+			wantUpdates: 0,
+		},
+		{
+			name:        "Test repositories with another package type are not adopted",
+			adopt:       true,
+			packageType: "maven",
+			layout:      "npm-default",
+			code:        conflictStateCode,
+			wantErr:     true,
+		},
+		{
+			name:        "Test repositories with another layout are not adopted",
+			adopt:       true,
+			packageType: "npm",
+			layout:      "simple-default",
+			code:        conflictStateCode,
+			wantErr:     true,
+		},
+		{
+			name:        "Test repositories managed for another namespace are not adopted",
+			adopt:       true,
+			packageType: "npm",
+			layout:      "npm-default",
+			notes:       managedNotes("other-namespace"),
+			code:        conflictStateCode,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &existingRepoArtifactoryClient{packageType: tt.packageType, layout: tt.layout, notes: tt.notes}
+			client := &Client{rt: rt}
+			recorder := &recordingEventRecorder{}
+			code, _, err := client.CreateRepositories(context.TODO(), "test-repo-npm", "npm", "test-namespace", 0, tt.adopt, recorder)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateRepositories() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := err.(*AdoptionError); tt.wantErr && !ok {
+				t.Errorf("CreateRepositories() error = %v, want *AdoptionError", err)
+			}
+			if code != tt.code {
+				t.Errorf("CreateRepositories() code = %v, want %v", code, tt.code)
+			}
+			if len(rt.updated) != tt.wantUpdates {
+				t.Errorf("CreateRepositories() updated = %v, want %v updates", rt.updated, tt.wantUpdates)
+			}
+			if len(recorder.reasons) != tt.wantUpdates {
+				t.Errorf("CreateRepositories() events = %v, want %v adoptions", recorder.reasons, tt.wantUpdates)
+			}
+			for _, notes := range rt.updated {
+				if !strings.HasPrefix(notes, managedNotes("test-namespace")) || !strings.HasSuffix(notes, tt.notes) {
+					t.Errorf("CreateRepositories() tagged notes = %v", notes)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_CreateRepositoriesGetErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantErr     error
+		wantCreated []string
+	}{
+		{
+			name:        "Test missing repositories are created",
+			err:         fmt.Errorf("repository test-repo-npm: %w", ErrNotFound),
+			wantCreated: []string{"test-repo-npm-local", "test-repo-npm"},
+		},
+		{
+			name:    "Test a failed lookup is returned instead of creating the repository",
+			err:     &APIError{StatusCode: http.StatusUnauthorized},
+			wantErr: ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &getErrorArtifactoryClient{err: tt.err}
+			client := &Client{rt: rt}
+			_, _, err := client.CreateRepositories(context.TODO(), "test-repo-npm", "npm", "test-namespace", 0, false, nil)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("CreateRepositories() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateRepositories() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(rt.created, tt.wantCreated) {
+				t.Errorf("CreateRepositories() created = %v, want %v", rt.created, tt.wantCreated)
+			}
+		})
+	}
+}
+
+// fakeArtifactory keeps the repositories created through its api in memory, it is safe for concurrent requests
+type fakeArtifactory struct {
+	mu    sync.Mutex
+	repos map[string]GenericRepoConfig
+}
+
+func (f *fakeArtifactory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/api/repositories/")
+	switch {
+	case r.URL.Path == "/api/repositories":
+		_ = json.NewEncoder(w).Encode([]RemoteRepo{{Key: r.URL.Query().Get("packageType") + "-remote", Rtype: "remote"}})
+	case r.Method == http.MethodGet:
+		repo, ok := f.repos[key]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(repo)
+	case r.Method == http.MethodPut:
+		var repo GenericRepoConfig
+		if err := json.NewDecoder(r.Body).Decode(&repo); err != nil || repo.Key != key {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.repos[key] = repo
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestClient_CreateRepositoriesConcurrently(t *testing.T) {
+	fake := &fakeArtifactory{repos: map[string]GenericRepoConfig{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: "basic", Username: "username", Password: "password"})
+
+	const workers = 8
+	var wg sync.WaitGroup
+	codes := make([]int, workers)
+	errs := make([]error, workers)
+	recorders := make([]*recordingEventRecorder, workers)
+	for i := 0; i < workers; i++ {
+		recorders[i] = &recordingEventRecorder{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Every worker creates its own repositories, and all of them adopt the shared ones
+			name := fmt.Sprintf("test-repo-%d-npm", i)
+			codes[i], _, errs[i] = client.CreateRepositories(context.TODO(), name, "npm", "test-namespace", 0, false, recorders[i])
+			if errs[i] == nil {
+				_, _, errs[i] = client.CreateRepositories(context.TODO(), "shared-npm", "npm", "test-namespace", 0, true, nil)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < workers; i++ {
+		if errs[i] != nil || codes[i] != okStateCode {
+			t.Errorf("CreateRepositories(%d) = %v, %v, want %v", i, codes[i], errs[i], okStateCode)
+		}
+		want := []string{EventReasonRepositoryCreated, EventReasonVirtualRepositoryCreated}
+		if !reflect.DeepEqual(recorders[i].reasons, want) {
+			t.Errorf("CreateRepositories(%d) events = %v, want %v", i, recorders[i].reasons, want)
+		}
+		for _, key := range []string{fmt.Sprintf("test-repo-%d-npm", i), fmt.Sprintf("test-repo-%d-npm-local", i)} {
+			if _, ok := fake.repos[key]; !ok {
+				t.Errorf("repository %s was not created", key)
+			}
+		}
+	}
+	if len(fake.repos) != 2*workers+2 {
+		t.Errorf("created %d repositories, want %d", len(fake.repos), 2*workers+2)
+	}
+}
+
+func TestClient_localRepoConfigDefaults(t *testing.T) {
+	xrayIndex := false
+	client := &Client{Config: &ClientConfig{RepositoryDefaults: map[string]RepositoryDefaults{
+		"npm": {LayoutRef: "npm-custom", XrayIndex: &xrayIndex},
+	}}}
+	npm := client.localRepoConfig("test-repo-npm", "npm", "test-namespace")
+	if npm.LayoutRef != "npm-custom" || npm.XrayIndex {
+		t.Errorf("localRepoConfig() npm = %+v, want the configured defaults", npm)
+	}
+	maven := client.localRepoConfig("test-repo-maven-release", "maven", "test-namespace")
+	if maven.LayoutRef != "maven-2-default" || !maven.XrayIndex {
+		t.Errorf("localRepoConfig() maven = %+v, want the built-in defaults", maven)
+	}
+}
+
+func TestClient_CheckDrift(t *testing.T) {
+	inSyncLocal := getLocalRepoConfig("test-repo-npm", "npm", "test-namespace", artifactoryClassLocal)
+	inSyncVirtual := getVirtualRepoConfig([]string{"remote-repo1", "remote-repo2"}, "test-repo-npm", "npm", "test-namespace", artifactoryClassVirtual)
+	driftedLocal := inSyncLocal
+	driftedLocal.XrayIndex = false
+	driftedVirtual := inSyncVirtual
+	driftedVirtual.Repositories = []string{"test-repo-npm-local"}
+	driftedVirtual.DefaultDeploymentRepo = ""
+
+	tests := []struct {
+		name        string
+		local       LocalRepoConfig
+		virtual     VirtualRepoConfig
+		correct     bool
+		wantDrift   []string
+		wantUpdates []string
+	}{
+		{
+			name:      "Test repositories in sync",
+			local:     inSyncLocal,
+			virtual:   inSyncVirtual,
+			wantDrift: []string{},
+		},
+		{
+			name:      "Test drift is reported",
+			local:     driftedLocal,
+			virtual:   driftedVirtual,
+			wantDrift: []string{"test-repo-npm-local: xrayIndex", "test-repo-npm: repositories", "test-repo-npm: defaultDeploymentRepo"},
+		},
+		{
+			name:        "Test drift is corrected",
+			local:       driftedLocal,
+			virtual:     driftedVirtual,
+			correct:     true,
+			wantDrift:   []string{"test-repo-npm-local: xrayIndex", "test-repo-npm: repositories", "test-repo-npm: defaultDeploymentRepo"},
+			wantUpdates: []string{"test-repo-npm-local", "test-repo-npm"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &driftArtifactoryClient{local: tt.local, virtual: tt.virtual}
+			client := &Client{rt: rt}
+			drifted, err := client.CheckDrift(context.TODO(), "test-repo-npm", "npm", "test-namespace", tt.correct)
+			if err != nil {
+				t.Fatalf("CheckDrift() error = %v", err)
+			}
+			if !reflect.DeepEqual(drifted, tt.wantDrift) {
+				t.Errorf("CheckDrift() = %v, want %v", drifted, tt.wantDrift)
+			}
+			if !reflect.DeepEqual(rt.updated, tt.wantUpdates) {
+				t.Errorf("CheckDrift() updated = %v, want %v", rt.updated, tt.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestClient_CheckDriftTurnsXrayIndexOff(t *testing.T) {
+	xrayIndex := false
+	config := &ClientConfig{RepositoryDefaults: map[string]RepositoryDefaults{"npm": {XrayIndex: &xrayIndex}}}
+	live := getLocalRepoConfig("test-repo-npm", "npm", "test-namespace", artifactoryClassLocal)
+	live.XrayIndex = true
+	virtual := getVirtualRepoConfig([]string{"remote-repo1", "remote-repo2"}, "test-repo-npm", "npm", "test-namespace", artifactoryClassVirtual)
+	rt := &driftArtifactoryClient{local: live, virtual: virtual}
+	client := &Client{Config: config, rt: rt}
+
+	drifted, err := client.CheckDrift(context.TODO(), "test-repo-npm", "npm", "test-namespace", true)
+	if err != nil {
+		t.Fatalf("CheckDrift() error = %v", err)
+	}
+	if !reflect.DeepEqual(drifted, []string{"test-repo-npm-local: xrayIndex"}) {
+		t.Errorf("CheckDrift() = %v, want the xray index drift", drifted)
+	}
+	body := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(rt.bodies["test-repo-npm-local"]), &body); err != nil {
+		t.Fatalf("CheckDrift() sent %q: %v", rt.bodies["test-repo-npm-local"], err)
+	}
+	if got, ok := body["xrayIndex"]; !ok || got != false {
+		t.Errorf("CheckDrift() sent %v, want xrayIndex false", rt.bodies["test-repo-npm-local"])
+	}
+}
+
+// driftArtifactoryClient returns the given live configs and records the updated repositories
+type driftArtifactoryClient struct {
+	mockArtifactoryClient
+	local   LocalRepoConfig
+	virtual VirtualRepoConfig
+	updated []string
+	bodies  map[string]string
+}
+
+func (R *driftArtifactoryClient) GetLocalRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+	return R.local, okStateCode, statusOKState, nil
+}
+
+func (R *driftArtifactoryClient) GetVirtualRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+	return R.virtual, okStateCode, statusOKState, nil
+}
+
+func (R *driftArtifactoryClient) UpdateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
+	R.updated = append(R.updated, key)
+	body, err := json.Marshal(r)
+	if err != nil {
+		return 500, statusInternalServerErrorState, err
+	}
+	if R.bodies == nil {
+		R.bodies = map[string]string{}
+	}
+	R.bodies[key] = string(body)
+	return okStateCode, statusOKState, nil
+}
+
+// existingRepoArtifactoryClient returns existing local and virtual repositories for every key
+type existingRepoArtifactoryClient struct {
+	mockArtifactoryClient
+	packageType string
+	layout      string
+	notes       string
+	updated     []string
+}
+
+func (R *existingRepoArtifactoryClient) GetLocalRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+	return LocalRepoConfig{
+		GenericRepoConfig: GenericRepoConfig{Key: key, RClass: "local", PackageType: R.packageType, LayoutRef: R.layout, Notes: R.notes},
+	}, okStateCode, statusOKState, nil
+}
+
+func (R *existingRepoArtifactoryClient) GetVirtualRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+	return VirtualRepoConfig{
+		GenericRepoConfig: GenericRepoConfig{Key: key, RClass: "virtual", PackageType: R.packageType, LayoutRef: R.layout, Notes: R.notes},
+	}, okStateCode, statusOKState, nil
+}
+
+func (R *existingRepoArtifactoryClient) UpdateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
+	R.updated = append(R.updated, r.(GenericRepoConfig).Notes)
+	return okStateCode, statusOKState, nil
+}
+
+// getErrorArtifactoryClient fails every lookup with the given error and records the created objects
+type getErrorArtifactoryClient struct {
+	mockArtifactoryClient
+	err     error
+	created []string
+}
+
+func (R *getErrorArtifactoryClient) GetLocalRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+	return LocalRepoConfig{}, 0, "", R.err
+}
+
+func (R *getErrorArtifactoryClient) GetVirtualRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+	return VirtualRepoConfig{}, 0, "", R.err
+}
+
+func (R *getErrorArtifactoryClient) GetPermissionTargetDetails(ctx context.Context, c *Client, key string, q map[string]string) (PermissionTargetDetails, int, string, error) {
+	return PermissionTargetDetails{}, 0, "", R.err
+}
+
+func (R *getErrorArtifactoryClient) CreateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
+	R.created = append(R.created, key)
+	return okStateCode, statusOKState, nil
+}
+
+func (R *getErrorArtifactoryClient) CreatePermissionTarget(ctx context.Context, c *Client, key string, p PermissionTargetDetails, q map[string]string) (int, string, error) {
+	R.created = append(R.created, key)
+	return okStateCode, statusOKState, nil
+}
+
 type mockArtifactoryClient struct{}
 
-func (R mockArtifactoryClient) GetLocalRepo(c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+type recordingEventRecorder struct {
+	reasons []string
+}
+
+func (r *recordingEventRecorder) Eventf(eventtype, reason, messageFmt string, args ...interface{}) {
+	r.reasons = append(r.reasons, reason)
+}
+
+func (R mockArtifactoryClient) GetLocalRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
 	gr := LocalRepoConfig{
 		GenericRepoConfig: GenericRepoConfig{
 			Key:    "test-repository",
@@ -102,7 +511,7 @@ func (R mockArtifactoryClient) GetLocalRepo(c *Client, key string, q map[string]
 	return gr, okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) GetVirtualRepo(c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+func (R mockArtifactoryClient) GetVirtualRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
 	gr := VirtualRepoConfig{
 		GenericRepoConfig: GenericRepoConfig{
 			Key:    "test-repository",
@@ -112,7 +521,7 @@ func (R mockArtifactoryClient) GetVirtualRepo(c *Client, key string, q map[strin
 	return gr, okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) GetRemoteRepos(c *Client, packageType string) ([]RemoteRepo, int, string, error) {
+func (R mockArtifactoryClient) GetRemoteRepos(ctx context.Context, c *Client, packageType string) ([]RemoteRepo, int, string, error) {
 	rr := []RemoteRepo{
 		{
 			Key:   "remote-repo1",
@@ -126,30 +535,38 @@ func (R mockArtifactoryClient) GetRemoteRepos(c *Client, packageType string) ([]
 	return rr, okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) CreateRepo(c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
+func (R mockArtifactoryClient) CreateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
+	return okStateCode, statusOKState, nil
+}
+
+func (R mockArtifactoryClient) UpdateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
 	return okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) DeleteRepo(c *Client, key string) (int, string, error) {
+func (R mockArtifactoryClient) DeleteRepo(ctx context.Context, c *Client, key string) (int, string, error) {
 	return okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) GetUser(c *Client, key string, q map[string]string) (RepositoryUser, int, string, error) {
+func (R mockArtifactoryClient) GetUser(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryUser, int, string, error) {
 	ru := RepositoryUser{
 		Name: "repo-test-user",
 	}
 	return ru, okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) CreateUser(c *Client, key string, u UserDetails, q map[string]string) (int, string, error) {
+func (R mockArtifactoryClient) CreateUser(ctx context.Context, c *Client, key string, u UserDetails, q map[string]string) (int, string, error) {
 	return okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) DeleteUser(c *Client, key string) (int, string, error) {
+func (R mockArtifactoryClient) UpdateUser(ctx context.Context, c *Client, key string, u UserDetails, q map[string]string) (int, string, error) {
 	return okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) GetPermissionTargetDetails(c *Client, key string, q map[string]string) (PermissionTargetDetails, int, string, error) {
+func (R mockArtifactoryClient) DeleteUser(ctx context.Context, c *Client, key string) (int, string, error) {
+	return okStateCode, statusOKState, nil
+}
+
+func (R mockArtifactoryClient) GetPermissionTargetDetails(ctx context.Context, c *Client, key string, q map[string]string) (PermissionTargetDetails, int, string, error) {
 	userList := []string{"test-user"}
 	u := map[string][]string{}
 	for _, each := range userList {
@@ -167,14 +584,26 @@ func (R mockArtifactoryClient) GetPermissionTargetDetails(c *Client, key string,
 	return pr, okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) CreatePermissionTarget(c *Client, key string, p PermissionTargetDetails, q map[string]string) (int, string, error) {
+func (R mockArtifactoryClient) CreatePermissionTarget(ctx context.Context, c *Client, key string, p PermissionTargetDetails, q map[string]string) (int, string, error) {
 	return okStateCode, statusOKState, nil
 }
 
-func (R mockArtifactoryClient) DeletePermissionTarget(c *Client, key string) (int, string, error) {
+func (R mockArtifactoryClient) DeletePermissionTarget(ctx context.Context, c *Client, key string) (int, string, error) {
 	return okStateCode, statusOKState, nil
 }
 
+func (R mockArtifactoryClient) CreateGroup(ctx context.Context, c *Client, key string, g GroupDetails, q map[string]string) (int, string, error) {
+	return okStateCode, statusOKState, nil
+}
+
+func (R mockArtifactoryClient) DeleteGroup(ctx context.Context, c *Client, key string) (int, string, error) {
+	return okStateCode, statusOKState, nil
+}
+
+func (R mockArtifactoryClient) CreateToken(ctx context.Context, c *Client, username string, scope string, expiresIn time.Duration) (tokenResponse, int, string, error) {
+	return tokenResponse{AccessToken: "access-token", ExpiresIn: int(expiresIn / time.Second)}, okStateCode, statusOKState, nil
+}
+
 func TestClient_CreateRepositoryUser(t *testing.T) {
 	client := &Client{
 		Client:    nil,
@@ -210,7 +639,7 @@ func TestClient_CreateRepositoryUser(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p, _, _, err := client.CreateRepositoryUser(tt.args.reqName)
+			p, _, _, err := client.CreateRepositoryUser(context.TODO(), tt.args.reqName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreateRepositoryUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -224,6 +653,90 @@ func TestClient_CreateRepositoryUser(t *testing.T) {
 	}
 }
 
+// Records the users created and updated, the users in exists are already in Artifactory
+type userArtifactoryClient struct {
+	mockArtifactoryClient
+	exists  map[string]bool
+	created []string
+	updated []string
+}
+
+func (R *userArtifactoryClient) GetUser(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryUser, int, string, error) {
+	if !R.exists[key] {
+		return RepositoryUser{}, http.StatusNotFound, "", &APIError{StatusCode: http.StatusNotFound}
+	}
+	return RepositoryUser{Name: key}, okStateCode, statusOKState, nil
+}
+
+func (R *userArtifactoryClient) CreateUser(ctx context.Context, c *Client, key string, u UserDetails, q map[string]string) (int, string, error) {
+	R.created = append(R.created, key)
+	return okStateCode, statusOKState, nil
+}
+
+func (R *userArtifactoryClient) UpdateUser(ctx context.Context, c *Client, key string, u UserDetails, q map[string]string) (int, string, error) {
+	if u.Password == "" {
+		return 400, "Bad Request", errors.New("the password is missing")
+	}
+	R.updated = append(R.updated, key)
+	return okStateCode, statusOKState, nil
+}
+
+func (R *userArtifactoryClient) DeleteUser(ctx context.Context, c *Client, key string) (int, string, error) {
+	if !R.exists[key] {
+		return http.StatusNotFound, "", &APIError{StatusCode: http.StatusNotFound}
+	}
+	delete(R.exists, key)
+	return okStateCode, statusOKState, nil
+}
+
+func TestClient_DeleteRepositoryUser(t *testing.T) {
+	rt := &userArtifactoryClient{exists: map[string]bool{"test-repo-repo-user": true}}
+	client := &Client{rt: rt}
+	for i := 0; i < 2; i++ {
+		if err := client.DeleteRepositoryUser(context.TODO(), "test-repo"); err != nil {
+			t.Errorf("DeleteRepositoryUser() error = %v, want a missing user to be no error", err)
+		}
+	}
+	if rt.exists["test-repo-repo-user"] {
+		t.Errorf("DeleteRepositoryUser() kept the user")
+	}
+}
+
+func TestClient_CreateRepositoryUserResetsPassword(t *testing.T) {
+	tests := []struct {
+		name        string
+		exists      bool
+		wantCreated []string
+		wantUpdated []string
+	}{
+		{
+			name:        "Test a new user is created",
+			wantCreated: []string{"test-repo-repo-user"},
+		},
+		{
+			name:        "Test the password of an existing user is reset",
+			exists:      true,
+			wantUpdated: []string{"test-repo-repo-user"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &userArtifactoryClient{exists: map[string]bool{"test-repo-repo-user": tt.exists}}
+			client := &Client{rt: rt}
+			p, _, _, err := client.CreateRepositoryUser(context.TODO(), "test-repo")
+			if err != nil {
+				t.Fatalf("CreateRepositoryUser() error = %v", err)
+			}
+			if p == "" {
+				t.Errorf("CreateRepositoryUser() generated no password")
+			}
+			if !reflect.DeepEqual(rt.created, tt.wantCreated) || !reflect.DeepEqual(rt.updated, tt.wantUpdated) {
+				t.Errorf("CreateRepositoryUser() created %v and updated %v, want %v and %v", rt.created, rt.updated, tt.wantCreated, tt.wantUpdated)
+			}
+		})
+	}
+}
+
 func TestClient_CleanupRepository(t *testing.T) {
 	client := &Client{
 		Client:    nil,
@@ -281,13 +794,204 @@ func TestClient_CleanupRepository(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := client.CleanupRepository(tt.args.reqName, tt.args.repoType, tt.args.namespace); (err != nil) != tt.wantErr {
+			if err := client.CleanupRepository(context.TODO(), tt.args.reqName, tt.args.repoType, tt.args.namespace); (err != nil) != tt.wantErr {
 				t.Errorf("CleanupRepository() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+func TestClient_CleanupRepositoryFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		repoType   string
+		code       int
+		err        error
+		wantFailed []string
+	}{
+		{
+			name:       "Test objects already gone count as deleted",
+			repoType:   "docker",
+			code:       http.StatusNotFound,
+			err:        &APIError{StatusCode: http.StatusNotFound, Messages: []string{"Repository test-repo-docker not found"}},
+			wantFailed: nil,
+		},
+		{
+			name:     "Test failed deletes are reported per object",
+			repoType: "docker",
+			code:     http.StatusInternalServerError,
+			err:      &APIError{StatusCode: http.StatusInternalServerError},
+			wantFailed: []string{
+				"test-repo-docker",
+				"test-repo-docker-local",
+				"test-repo-docker-repo-permission",
+				"test-repo-repo-group",
+				"test-repo-repo-user",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{
+				rt: &failingDeleteArtifactoryClient{code: tt.code, err: tt.err},
+			}
+			err := client.CleanupRepository(context.TODO(), "test-repo", tt.repoType, "test-namespace")
+			if tt.wantFailed == nil {
+				if err != nil {
+					t.Errorf("CleanupRepository() error = %v, want nil", err)
+				}
+				return
+			}
+			cleanupErr, ok := err.(*CleanupError)
+			if !ok {
+				t.Fatalf("CleanupRepository() error = %v, want *CleanupError", err)
+			}
+			failed := []string{}
+			for key := range cleanupErr.Failed {
+				failed = append(failed, key)
+			}
+			sort.Strings(failed)
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("CleanupRepository() failed = %v, want %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestClient_ArchiveRepository(t *testing.T) {
+	rt := &recordingArtifactoryClient{}
+	client := &Client{rt: rt}
+	err := client.ArchiveRepository(context.TODO(), "test-repo", "maven", "test-namespace")
+	if err != nil {
+		t.Fatalf("ArchiveRepository() error = %v", err)
+	}
+	wantBlackedOut := []string{
+		"test-repo-maven-release",
+		"test-repo-maven-release-local",
+		"test-repo-maven-snapshot",
+		"test-repo-maven-snapshot-local",
+	}
+	sort.Strings(rt.blackedOut)
+	if !reflect.DeepEqual(rt.blackedOut, wantBlackedOut) {
+		t.Errorf("ArchiveRepository() blacked out = %v, want %v", rt.blackedOut, wantBlackedOut)
+	}
+	if len(rt.deletedRepos) != 0 {
+		t.Errorf("ArchiveRepository() deleted repositories %v", rt.deletedRepos)
+	}
+	if !reflect.DeepEqual(rt.deletedPermissions, []string{"test-repo-maven-repo-permission"}) {
+		t.Errorf("ArchiveRepository() deleted permissions = %v", rt.deletedPermissions)
+	}
+}
+
+// recordingArtifactoryClient records the updates and deletes sent to Artifactory
+type recordingArtifactoryClient struct {
+	mockArtifactoryClient
+	blackedOut         []string
+	deletedRepos       []string
+	deletedPermissions []string
+}
+
+func (R *recordingArtifactoryClient) UpdateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
+	if r.(GenericRepoConfig).BlackedOut {
+		R.blackedOut = append(R.blackedOut, key)
+	}
+	return okStateCode, statusOKState, nil
+}
+
+func (R *recordingArtifactoryClient) DeleteRepo(ctx context.Context, c *Client, key string) (int, string, error) {
+	R.deletedRepos = append(R.deletedRepos, key)
+	return okStateCode, statusOKState, nil
+}
+
+func (R *recordingArtifactoryClient) DeletePermissionTarget(ctx context.Context, c *Client, key string) (int, string, error) {
+	R.deletedPermissions = append(R.deletedPermissions, key)
+	return okStateCode, statusOKState, nil
+}
+
+// failingDeleteArtifactoryClient fails every delete with the given code and error
+type failingDeleteArtifactoryClient struct {
+	mockArtifactoryClient
+	code int
+	err  error
+}
+
+func (R failingDeleteArtifactoryClient) DeleteRepo(ctx context.Context, c *Client, key string) (int, string, error) {
+	return R.code, "", R.err
+}
+
+func (R failingDeleteArtifactoryClient) DeleteUser(ctx context.Context, c *Client, key string) (int, string, error) {
+	return R.code, "", R.err
+}
+
+func (R failingDeleteArtifactoryClient) DeletePermissionTarget(ctx context.Context, c *Client, key string) (int, string, error) {
+	return R.code, "", R.err
+}
+
+func (R failingDeleteArtifactoryClient) DeleteGroup(ctx context.Context, c *Client, key string) (int, string, error) {
+	return R.code, "", R.err
+}
+
+// tokenArtifactoryClient records the groups, tokens and permission targets which are created
+type tokenArtifactoryClient struct {
+	mockArtifactoryClient
+	groups      []string
+	scopes      []string
+	permissions []PermissionTargetDetails
+}
+
+func (R *tokenArtifactoryClient) GetPermissionTargetDetails(ctx context.Context, c *Client, key string, q map[string]string) (PermissionTargetDetails, int, string, error) {
+	return PermissionTargetDetails{}, http.StatusNotFound, "", &APIError{StatusCode: http.StatusNotFound}
+}
+
+func (R *tokenArtifactoryClient) CreatePermissionTarget(ctx context.Context, c *Client, key string, p PermissionTargetDetails, q map[string]string) (int, string, error) {
+	R.permissions = append(R.permissions, p)
+	return okStateCode, statusOKState, nil
+}
+
+func (R *tokenArtifactoryClient) CreateGroup(ctx context.Context, c *Client, key string, g GroupDetails, q map[string]string) (int, string, error) {
+	R.groups = append(R.groups, key)
+	return okStateCode, statusOKState, nil
+}
+
+func (R *tokenArtifactoryClient) CreateToken(ctx context.Context, c *Client, username string, scope string, expiresIn time.Duration) (tokenResponse, int, string, error) {
+	R.scopes = append(R.scopes, scope)
+	return tokenResponse{AccessToken: "access-token", ExpiresIn: int(expiresIn / time.Second)}, okStateCode, statusOKState, nil
+}
+
+func TestClient_CreateRepositoryToken(t *testing.T) {
+	rt := &tokenArtifactoryClient{}
+	client := &Client{rt: rt}
+	before := time.Now()
+	token, err := client.CreateRepositoryToken(context.TODO(), "test-repo", time.Hour)
+	if err != nil {
+		t.Fatalf("CreateRepositoryToken() error = %v", err)
+	}
+	if token.Username != "test-repo-repo-user" || token.Token != "access-token" {
+		t.Errorf("CreateRepositoryToken() = %+v, want the token of test-repo-repo-user", token)
+	}
+	if token.Expiry.Before(before.Add(time.Hour)) || token.Expiry.After(time.Now().Add(time.Hour)) {
+		t.Errorf("CreateRepositoryToken() expiry = %v, want in an hour", token.Expiry)
+	}
+	if !reflect.DeepEqual(rt.groups, []string{"test-repo-repo-group"}) || !reflect.DeepEqual(rt.scopes, []string{"member-of-groups:test-repo-repo-group"}) {
+		t.Errorf("CreateRepositoryToken() created groups %v and scopes %v, want the group of the repository", rt.groups, rt.scopes)
+	}
+}
+
+func TestClient_CreatePermissionForGroup(t *testing.T) {
+	rt := &tokenArtifactoryClient{}
+	client := &Client{rt: rt}
+	err := client.CreatePermission(context.TODO(), "test-repo", "docker", "test-namespace", nil, []string{"test-repo-repo-group"}, []string{"test-repo-docker-local"}, nil)
+	if err != nil {
+		t.Fatalf("CreatePermission() error = %v", err)
+	}
+	if len(rt.permissions) != 1 {
+		t.Fatalf("CreatePermission() created %d permission targets, want 1", len(rt.permissions))
+	}
+	if got := rt.permissions[0].Principals.Groups["test-repo-repo-group"]; !reflect.DeepEqual(got, []string{"r", "d", "w", "n"}) {
+		t.Errorf("CreatePermission() granted %v to the group, want push and pull", got)
+	}
+}
+
 func TestClient_CreatePermission(t *testing.T) {
 	client := &Client{
 		Client:    nil,
@@ -343,9 +1047,45 @@ func TestClient_CreatePermission(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := client.CreatePermission(tt.args.reqName, tt.args.repoType, tt.args.namespace, tt.args.users, tt.args.repositories); (err != nil) != tt.wantErr {
+			if err := client.CreatePermission(context.TODO(), tt.args.reqName, tt.args.repoType, tt.args.namespace, tt.args.users, nil, tt.args.repositories, nil); (err != nil) != tt.wantErr {
 				t.Errorf("CreatePermission() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestClient_CreatePermissionGetErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantErr     error
+		wantCreated []string
+	}{
+		{
+			name:        "Test a missing permission target is created",
+			err:         &APIError{StatusCode: http.StatusNotFound},
+			wantCreated: []string{"test-repo-maven-repo-permission"},
+		},
+		{
+			name:    "Test a failed lookup is returned instead of replacing the permission target",
+			err:     &APIError{StatusCode: http.StatusForbidden},
+			wantErr: ErrUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := &getErrorArtifactoryClient{err: tt.err}
+			client := &Client{rt: rt}
+			err := client.CreatePermission(context.TODO(), "test-repo", "maven", "test-namespace", []string{"test-user"}, nil, nil, nil)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("CreatePermission() error = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreatePermission() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(rt.created, tt.wantCreated) {
+				t.Errorf("CreatePermission() created = %v, want %v", rt.created, tt.wantCreated)
+			}
+		})
+	}
+}
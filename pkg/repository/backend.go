@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBackendNotConfigured is returned by a Backend which has no valid client config
+var ErrBackendNotConfigured = errors.New("artifactory backend is not configured")
+
+// Backend is an Artifactory client whose config can be replaced while it's in use, e.g. when rotated
+// credentials are loaded. Every call uses the client which is current when the call starts.
+type Backend struct {
+	mu     sync.RWMutex
+	client *Client
+	reason error
+}
+
+// NewBackend returns a Backend which isn't configured yet
+func NewBackend() *Backend {
+	return &Backend{reason: errors.New("no client config was loaded")}
+}
+
+// Configure validates the config and replaces the client with a new one for it. An invalid config
+// leaves the backend not configured, the error is reported by every following call.
+func (b *Backend) Configure(conf *ClientConfig) error {
+	if err := conf.Validate(); err != nil {
+		b.Unconfigure(err)
+		return err
+	}
+	client := NewClient(conf)
+	b.mu.Lock()
+	previous := b.client
+	b.client, b.reason = &client, nil
+	b.mu.Unlock()
+	if previous != nil && previous.Transport != nil && previous.Transport != client.Transport {
+		// Requests in flight finish on the previous client, its idle connections aren't reused
+		previous.Transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Unconfigure drops the client, the reason is reported by every following call
+func (b *Backend) Unconfigure(reason error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.client, b.reason = nil, reason
+}
+
+// Configured returns nil when the backend has a client, else an error wrapping ErrBackendNotConfigured
+func (b *Backend) Configured() error {
+	_, err := b.current()
+	return err
+}
+
+// BaseURL returns the Artifactory url of the current client, empty when the backend is not configured
+func (b *Backend) BaseURL() string {
+	c, err := b.current()
+	if err != nil || c.Config == nil {
+		return ""
+	}
+	return c.Config.BaseURL
+}
+
+func (b *Backend) current() (*Client, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.client == nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackendNotConfigured, b.reason)
+	}
+	return b.client, nil
+}
+
+// CreateRepositories : see Client.CreateRepositories
+func (b *Backend) CreateRepositories(ctx context.Context, repoName string, repoType string, namespace string, statusCode int, adopt bool, recorder EventRecorder) (int, string, error) {
+	c, err := b.current()
+	if err != nil {
+		return 0, "", err
+	}
+	return c.CreateRepositories(ctx, repoName, repoType, namespace, statusCode, adopt, recorder)
+}
+
+// CreatePermission : see Client.CreatePermission
+func (b *Backend) CreatePermission(ctx context.Context, reqName string, repoType string, namespace string, users []string, groups []string, repositories []string, recorder EventRecorder) error {
+	c, err := b.current()
+	if err != nil {
+		return err
+	}
+	return c.CreatePermission(ctx, reqName, repoType, namespace, users, groups, repositories, recorder)
+}
+
+// CreateRepositoryUser : see Client.CreateRepositoryUser
+func (b *Backend) CreateRepositoryUser(ctx context.Context, reqName string) (string, int, string, error) {
+	c, err := b.current()
+	if err != nil {
+		return "", 0, "", err
+	}
+	return c.CreateRepositoryUser(ctx, reqName)
+}
+
+// DeleteRepositoryUser : see Client.DeleteRepositoryUser
+func (b *Backend) DeleteRepositoryUser(ctx context.Context, reqName string) error {
+	c, err := b.current()
+	if err != nil {
+		return err
+	}
+	return c.DeleteRepositoryUser(ctx, reqName)
+}
+
+// CreateRepositoryToken : see Client.CreateRepositoryToken
+func (b *Backend) CreateRepositoryToken(ctx context.Context, reqName string, expiresIn time.Duration) (RepositoryToken, error) {
+	c, err := b.current()
+	if err != nil {
+		return RepositoryToken{}, err
+	}
+	return c.CreateRepositoryToken(ctx, reqName, expiresIn)
+}
+
+// CleanupRepository : see Client.CleanupRepository
+func (b *Backend) CleanupRepository(ctx context.Context, reqName string, repoType string, namespace string) error {
+	c, err := b.current()
+	if err != nil {
+		return err
+	}
+	return c.CleanupRepository(ctx, reqName, repoType, namespace)
+}
+
+// ArchiveRepository : see Client.ArchiveRepository
+func (b *Backend) ArchiveRepository(ctx context.Context, reqName string, repoType string, namespace string) error {
+	c, err := b.current()
+	if err != nil {
+		return err
+	}
+	return c.ArchiveRepository(ctx, reqName, repoType, namespace)
+}
+
+// DeletePermission : see Client.DeletePermission
+func (b *Backend) DeletePermission(ctx context.Context, reqName string, repoType string, namespace string) error {
+	c, err := b.current()
+	if err != nil {
+		return err
+	}
+	return c.DeletePermission(ctx, reqName, repoType, namespace)
+}
+
+// CheckDrift : see Client.CheckDrift
+func (b *Backend) CheckDrift(ctx context.Context, repoName string, repoType string, namespace string, correct bool) ([]string, error) {
+	c, err := b.current()
+	if err != nil {
+		return nil, err
+	}
+	return c.CheckDrift(ctx, repoName, repoType, namespace, correct)
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestBackendNotConfigured(t *testing.T) {
+	b := NewBackend()
+	if err := b.Configured(); !errors.Is(err, ErrBackendNotConfigured) {
+		t.Errorf("Configured() = %v, want ErrBackendNotConfigured", err)
+	}
+	if _, _, err := b.CreateRepositories(context.TODO(), "test", "npm", "ns", 0, false, nil); !errors.Is(err, ErrBackendNotConfigured) {
+		t.Errorf("CreateRepositories() = %v, want ErrBackendNotConfigured", err)
+	}
+	if err := b.Configure(&ClientConfig{BaseURL: "https://artifactory", AuthMethod: "basic", Username: "admin"}); err == nil {
+		t.Error("Configure() = nil, want an error for the missing password")
+	}
+	if err := b.Configured(); !errors.Is(err, ErrBackendNotConfigured) {
+		t.Errorf("Configured() = %v, want ErrBackendNotConfigured after an invalid config", err)
+	}
+}
+
+func TestBackendConfigureSwapsClient(t *testing.T) {
+	b := NewBackend()
+	if err := b.Configure(&ClientConfig{BaseURL: "https://old", AuthMethod: "token", Token: "old"}); err != nil {
+		t.Fatalf("Configure() = %v", err)
+	}
+	old, _ := b.current()
+	if err := b.Configure(&ClientConfig{BaseURL: "https://new", AuthMethod: "token", Token: "new"}); err != nil {
+		t.Fatalf("Configure() = %v", err)
+	}
+	c, err := b.current()
+	if err != nil || c.Config.Token != "new" || c.Config.BaseURL != "https://new" {
+		t.Errorf("current() = %+v, %v, want the new client", c, err)
+	}
+	if old.Config.Token != "old" {
+		t.Errorf("previous client token = %q, want it unchanged for requests in flight", old.Config.Token)
+	}
+	if err := b.Configure(&ClientConfig{BaseURL: "https://new"}); err == nil {
+		t.Error("Configure() = nil, want an error for the missing credentials")
+	}
+	if err := b.Configured(); !errors.Is(err, ErrBackendNotConfigured) {
+		t.Errorf("Configured() = %v, want ErrBackendNotConfigured", err)
+	}
+}
+
+func TestBackendConfigureConcurrently(t *testing.T) {
+	b := NewBackend()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i%2 == 0 {
+					_ = b.Configure(&ClientConfig{BaseURL: "https://artifactory", AuthMethod: "token", Token: "token"})
+				} else {
+					_ = b.Configured()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := b.Configured(); err != nil {
+		t.Errorf("Configured() = %v, want nil", err)
+	}
+}
+
+func TestNewClientTrustsCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	conf := &ClientConfig{BaseURL: server.URL, AuthMethod: "token", Token: "token", VerifySSL: true, CACert: caCert}
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	client := NewClient(conf)
+	if _, err := client.Client.Get(server.URL); err != nil {
+		t.Errorf("Get() = %v, want the CA bundle to be trusted", err)
+	}
+	untrusted := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: "token", Token: "token", VerifySSL: true})
+	if _, err := untrusted.Client.Get(server.URL); err == nil {
+		t.Error("Get() = nil, want a certificate error without the CA bundle")
+	}
+	conf.CACert = []byte("not a certificate")
+	if err := conf.Validate(); err == nil {
+		t.Error("Validate() = nil, want an error for an invalid CA bundle")
+	}
+}
@@ -3,20 +3,69 @@ package repository
 import (
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 )
 
+// DefaultRequestTimeout is the time limit for a single Artifactory request
+const DefaultRequestTimeout = 30 * time.Second
+
 // ClientConfig is the configuration for an REPOSITORY Client
 type ClientConfig struct {
-	BaseURL    string
-	Username   string
-	Password   string
-	Token      string
+	BaseURL  string
+	Username string
+	Password string
+	// Token is the API key, or the access token with the bearer AuthMethod
+	Token string
+	// RefreshToken exchanges an expiring access token for a new one with the bearer AuthMethod
+	RefreshToken string
+	// TokensRefreshed is called with the new access and refresh token after the access token was refreshed,
+	// e.g. to store them where the tokens were loaded from
+	TokensRefreshed func(accessToken string, refreshToken string)
+	// AuthMethod is AuthMethodBasic, AuthMethodToken or AuthMethodBearer
 	AuthMethod string
-	VerifySSL  bool
-	Client     *http.Client
-	Transport  *http.Transport
+	// VerifySSL verifies the certificate of Artifactory, it's always verified when CACert is set
+	VerifySSL bool
+	Client    *http.Client
+	Transport *http.Transport
+	// Timeout is the time limit for a single request, zero means no limit
+	Timeout time.Duration
+	// MaxRetries is how often an idempotent request is retried after a transient failure
+	MaxRetries int
+	// RateLimit is the number of requests per second sent by the client, zero means no limit
+	RateLimit float64
+	// RateBurst is the number of requests which may be sent at once before the rate limit applies
+	RateBurst int
+	// Debug logs every request with its redacted headers and body, and the status and latency of its response
+	Debug bool
+	// Naming holds the templates for the names of the users and permission targets
+	Naming Naming
+	// PasswordPolicy describes the passwords of the repository users, empty uses the DefaultPasswordPolicy
+	PasswordPolicy PasswordPolicy
+	// RepositoryDefaults are the settings of the local repositories by repotype
+	RepositoryDefaults map[string]RepositoryDefaults
+	// CACert is a PEM bundle of the certificate authorities trusted for Artifactory, the system pool is used when empty
+	CACert []byte
+	// ClientCert and ClientKey are the PEM certificate and key presented to Artifactory for mutual TLS
+	ClientCert []byte
+	ClientKey  []byte
+	// MinTLSVersion is the lowest TLS version accepted, e.g. tls.VersionTLS12, zero keeps the Go default
+	MinTLSVersion uint16
+	// ProxyURL is the proxy for the requests to Artifactory, HTTPS_PROXY and HTTP_PROXY are used when it's empty
+	ProxyURL string
+	// NoProxy lists the hosts which are reached without the proxy in the NO_PROXY format, NO_PROXY is used when it's empty
+	NoProxy string
+}
+
+// RepositoryDefaults are settings of the local repositories of a repotype which replace the built-in ones
+type RepositoryDefaults struct {
+	// LayoutRef is the repository layout, empty keeps the built-in layout
+	LayoutRef string
+	// XrayIndex enables the indexing by Xray, nil keeps the built-in setting
+	XrayIndex *bool
 }
 
 // Client is a client for interacting with REPOSITORY
@@ -25,6 +74,7 @@ type Client struct {
 	Config    *ClientConfig
 	Transport *http.Transport
 	rt        rtInterface
+	tokens    *accessTokens
 }
 
 // NewRepositoryClient : Create new repository client from environment variable
@@ -41,44 +91,152 @@ func NewRepositoryClient() *Client {
 
 // NewClient returns a new REPOSITORY Client with the provided ClientConfig
 func NewClient(config *ClientConfig) Client {
-	verifySSL := func() bool {
-		return !config.VerifySSL
-	}
+	// The config is validated before, an invalid TLS or proxy setting falls back to the default
 	if config.Transport == nil {
 		config.Transport = &http.Transport{}
+		config.Transport.Proxy, _ = config.proxy()
+	} else if config.ProxyURL != "" || config.NoProxy != "" {
+		config.Transport.Proxy, _ = config.proxy()
+	}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		tlsConfig = &tls.Config{InsecureSkipVerify: !config.verifyCertificate(), MinVersion: config.MinTLSVersion}
 	}
-	config.Transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: verifySSL()}
+	config.Transport.TLSClientConfig = tlsConfig
 	if config.Client == nil {
-		config.Client = &http.Client{}
+		config.Client = &http.Client{Timeout: config.Timeout}
 	}
-	config.Client.Transport = config.Transport
-	return Client{Client: config.Client, Config: config, Transport: config.Transport, rt: RTFactory{}}
+	config.Client.Transport = newRetryTransport(config.Transport, config.MaxRetries, config.RateLimit, config.RateBurst)
+	client := Client{Client: config.Client, Config: config, Transport: config.Transport, rt: RTFactory{}}
+	if config.AuthMethod == AuthMethodBearer {
+		client.tokens = newAccessTokens(config.Token, config.RefreshToken)
+	}
+	return client
 }
 
 func clientConfigFrom(from string) (*ClientConfig, error) {
-	conf := ClientConfig{}
+	conf := DefaultClientConfig()
 	switch from {
 	case "environment":
-		if os.Getenv("REPOSITORY_URL") == "" {
-			return nil, errors.New("You must set the environment variable REPOSITORY_URL")
+		if err := conf.ApplyEnvironment(); err != nil {
+			return nil, err
 		}
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
 
-		conf.BaseURL = os.Getenv("REPOSITORY_URL")
-		if os.Getenv("REPOSITORY_TOKEN") == "" {
-			if os.Getenv("REPOSITORY_USERNAME") == "" || os.Getenv("REPOSITORY_PASSWORD") == "" {
-				return nil, errors.New("You must set the environment variables REPOSITORY_USERNAME & REPOSITORY_PASSWORD")
-			}
+// DefaultClientConfig returns a config with the default timeout, retries and rate limit
+func DefaultClientConfig() *ClientConfig {
+	return &ClientConfig{
+		Timeout:    DefaultRequestTimeout,
+		MaxRetries: DefaultMaxRetries,
+		RateLimit:  DefaultRateLimit,
+		RateBurst:  DefaultRateBurst,
+	}
+}
 
-			conf.AuthMethod = "basic"
-		} else {
-			conf.AuthMethod = "token"
+// ApplyEnvironment sets the url, the credentials and the request settings from the REPOSITORY_* environment variables
+// which are set
+func (conf *ClientConfig) ApplyEnvironment() error {
+	if url := os.Getenv("REPOSITORY_URL"); url != "" {
+		conf.BaseURL = url
+	}
+	if timeout := os.Getenv("REPOSITORY_REQUEST_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return errors.New("REPOSITORY_REQUEST_TIMEOUT must be a duration like 30s: " + err.Error())
+		}
+		conf.Timeout = d
+	}
+	if maxRetries := os.Getenv("REPOSITORY_MAX_RETRIES"); maxRetries != "" {
+		n, err := strconv.Atoi(maxRetries)
+		if err != nil || n < 0 {
+			return errors.New("REPOSITORY_MAX_RETRIES must be a number of retries")
+		}
+		conf.MaxRetries = n
+	}
+	if rateLimit := os.Getenv("REPOSITORY_RATE_LIMIT"); rateLimit != "" {
+		f, err := strconv.ParseFloat(rateLimit, 64)
+		if err != nil || f < 0 {
+			return errors.New("REPOSITORY_RATE_LIMIT must be a number of requests per second")
 		}
+		conf.RateLimit = f
 	}
-	if conf.AuthMethod == "token" {
-		conf.Token = os.Getenv("REPOSITORY_TOKEN")
+	if rateBurst := os.Getenv("REPOSITORY_RATE_BURST"); rateBurst != "" {
+		n, err := strconv.Atoi(rateBurst)
+		if err != nil || n < 1 {
+			return errors.New("REPOSITORY_RATE_BURST must be a positive number of requests")
+		}
+		conf.RateBurst = n
+	}
+	if proxyURL := os.Getenv("REPOSITORY_PROXY_URL"); proxyURL != "" {
+		conf.ProxyURL = proxyURL
+	}
+	if noProxy := os.Getenv("REPOSITORY_NO_PROXY"); noProxy != "" {
+		conf.NoProxy = noProxy
+	}
+	if verifySSL := os.Getenv("REPOSITORY_VERIFY_SSL"); verifySSL != "" {
+		v, err := strconv.ParseBool(verifySSL)
+		if err != nil {
+			return errors.New("REPOSITORY_VERIFY_SSL must be true or false")
+		}
+		conf.VerifySSL = v
+	}
+	if minTLSVersion := os.Getenv("REPOSITORY_MIN_TLS_VERSION"); minTLSVersion != "" {
+		v, err := ParseTLSVersion(minTLSVersion)
+		if err != nil {
+			return errors.New("REPOSITORY_MIN_TLS_VERSION: " + err.Error())
+		}
+		conf.MinTLSVersion = v
+	}
+	if os.Getenv("REPOSITORY_DEBUG") != "" {
+		conf.Debug = true
+	}
+	if token := os.Getenv("REPOSITORY_ACCESS_TOKEN"); token != "" {
+		conf.AuthMethod = AuthMethodBearer
+		conf.Token = token
+		conf.RefreshToken = os.Getenv("REPOSITORY_REFRESH_TOKEN")
+	} else if token := os.Getenv("REPOSITORY_TOKEN"); token != "" {
+		conf.AuthMethod = AuthMethodToken
+		conf.Token = token
 	} else {
+		conf.AuthMethod = AuthMethodBasic
 		conf.Username = os.Getenv("REPOSITORY_USERNAME")
 		conf.Password = os.Getenv("REPOSITORY_PASSWORD")
 	}
-	return &conf, nil
+	return nil
+}
+
+// Validate checks that the config has a url and credentials
+func (conf *ClientConfig) Validate() error {
+	if conf.BaseURL == "" {
+		return errors.New("You must set the environment variable REPOSITORY_URL")
+	}
+	if conf.AuthMethod == AuthMethodToken {
+		if conf.Token == "" {
+			return errors.New("You must set the environment variable REPOSITORY_TOKEN")
+		}
+	} else if conf.AuthMethod == AuthMethodBearer {
+		if conf.Token == "" {
+			return errors.New("You must set the environment variable REPOSITORY_ACCESS_TOKEN")
+		}
+		if expiry := tokenExpiry(conf.Token); conf.RefreshToken == "" && !expiry.IsZero() && !time.Now().Before(expiry) {
+			return fmt.Errorf("%w at %s and no refresh token is configured", ErrTokenExpired, expiry.Format(time.RFC3339))
+		}
+	} else if conf.Username == "" || conf.Password == "" {
+		return errors.New("You must set the environment variables REPOSITORY_USERNAME & REPOSITORY_PASSWORD")
+	}
+	if _, err := conf.tlsConfig(); err != nil {
+		return err
+	}
+	if _, err := conf.proxy(); err != nil {
+		return err
+	}
+	if err := conf.PasswordPolicy.Validate(); err != nil {
+		return err
+	}
+	return conf.Naming.Validate()
 }
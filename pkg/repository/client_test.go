@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"context"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -195,3 +198,64 @@ func TestNewRepositoryClientErrorCredentialVariables(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestHonoursContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: "basic"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, _, err := Get(ctx, &client, "/api/repositories/test-repo", nil)
+	if err == nil {
+		t.Fatal("Get() did not fail after the context deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Get() returned after %v, want it to stop at the deadline", elapsed)
+	}
+}
+
+func TestClientConfigRequestTimeout(t *testing.T) {
+	_ = os.Setenv("REPOSITORY_URL", "http://artifactory.server.com") //nolint
+	_ = os.Setenv("REPOSITORY_USERNAME", "admin")                    //nolint
+	_ = os.Setenv("REPOSITORY_PASSWORD", "password")                 //nolint
+	_ = os.Setenv("REPOSITORY_TOKEN", "")                            //nolint
+	defer func() { _ = os.Unsetenv("REPOSITORY_REQUEST_TIMEOUT") }() //nolint
+
+	conf, err := clientConfigFrom("environment")
+	if err != nil || conf.Timeout != DefaultRequestTimeout {
+		t.Errorf("clientConfigFrom() timeout = %v, %v, want %v", conf, err, DefaultRequestTimeout)
+	}
+	_ = os.Setenv("REPOSITORY_REQUEST_TIMEOUT", "5s") //nolint
+	conf, err = clientConfigFrom("environment")
+	if err != nil || conf.Timeout != 5*time.Second {
+		t.Errorf("clientConfigFrom() timeout = %v, %v, want 5s", conf, err)
+	}
+	_ = os.Setenv("REPOSITORY_REQUEST_TIMEOUT", "soon") //nolint
+	if _, err = clientConfigFrom("environment"); err == nil {
+		t.Errorf("clientConfigFrom() accepted an invalid timeout")
+	}
+}
+
+func TestClientConfigVerifySSL(t *testing.T) {
+	_ = os.Setenv("REPOSITORY_URL", "http://artifactory.server.com") //nolint
+	_ = os.Setenv("REPOSITORY_USERNAME", "admin")                    //nolint
+	_ = os.Setenv("REPOSITORY_PASSWORD", "password")                 //nolint
+	_ = os.Setenv("REPOSITORY_TOKEN", "")                            //nolint
+	defer func() { _ = os.Unsetenv("REPOSITORY_VERIFY_SSL") }()      //nolint
+
+	_ = os.Setenv("REPOSITORY_VERIFY_SSL", "true") //nolint
+	conf, err := clientConfigFrom("environment")
+	if err != nil || !conf.VerifySSL {
+		t.Errorf("clientConfigFrom() verifySSL = %v, %v, want true", conf, err)
+	}
+	_ = os.Setenv("REPOSITORY_VERIFY_SSL", "yes please") //nolint
+	if _, err = clientConfigFrom("environment"); err == nil {
+		t.Errorf("clientConfigFrom() accepted an invalid verifySSL")
+	}
+}
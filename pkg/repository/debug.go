@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replaces the value of a sensitive header or field in the debug log
+const redacted = "REDACTED"
+
+// Headers which carry credentials
+var sensitiveHeaders = []string{"Authorization", "X-JFrog-Art-Api", "Cookie", "Set-Cookie"}
+
+// JSON fields whose name contains one of these, compared in lower case, carry credentials
+var sensitiveFields = []string{"password", "apikey", "api_key", "token", "secret"}
+
+type debugKey struct{}
+
+// WithDebug returns a context which enables the debug log for the requests sent with it,
+// regardless of the Debug setting of the client
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+// debugEnabled tells whether the requests of the client sent with the context are logged
+func (c *Client) debugEnabled(ctx context.Context) bool {
+	if c.Config.Debug {
+		return true
+	}
+	debug, _ := ctx.Value(debugKey{}).(bool)
+	return debug
+}
+
+// Log a request with its redacted headers and body
+func logRequest(req *http.Request, body []byte) {
+	log.Info("Artifactory request", "method", req.Method, "path", req.URL.Path, "query", req.URL.RawQuery,
+		"headers", redactHeaders(req.Header), "body", redactBody(body))
+}
+
+// Log the outcome of a request, code is 0 when no response was received
+func logResponse(req *http.Request, code int, start time.Time, err error) {
+	keysAndValues := []interface{}{"method", req.Method, "path", req.URL.Path, "status", code, "latency", time.Since(start).String()}
+	if err != nil {
+		keysAndValues = append(keysAndValues, "error", err.Error())
+	}
+	log.Info("Artifactory response", keysAndValues...)
+}
+
+// Copy of the headers with the credentials replaced
+func redactHeaders(header http.Header) http.Header {
+	copied := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if copied.Get(name) != "" {
+			copied.Set(name, redacted)
+		}
+	}
+	return copied
+}
+
+// The body with the values of the sensitive fields replaced. A body which isn't JSON is only logged with its size,
+// it could hold credentials which can't be found.
+func redactBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "<" + strconv.Itoa(len(body)) + " bytes>"
+	}
+	data, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return "<" + strconv.Itoa(len(body)) + " bytes>"
+	}
+	return string(data)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, field := range value {
+			if isSensitiveField(k) {
+				value[k] = redacted
+			} else {
+				value[k] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item)
+		}
+	}
+	return v
+}
+
+func isSensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveFields {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_redactBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "Test the password of a new user is redacted",
+			body: `{"name":"test-repo-user","password":"s3cr3t!","groups":["readers"]}`,
+			want: `{"groups":["readers"],"name":"test-repo-user","password":"REDACTED"}`,
+		},
+		{
+			name: "Test nested api keys and tokens are redacted",
+			body: `{"repo":{"apiKey":"AKCp5","items":[{"access_token":"eyJ","refresh_token":"r1"}]}}`,
+			want: `{"repo":{"apiKey":"REDACTED","items":[{"access_token":"REDACTED","refresh_token":"REDACTED"}]}}`,
+		},
+		{
+			name: "Test a body which isn't json is only logged with its size",
+			body: "grant_type=refresh_token&refresh_token=r1",
+			want: "<41 bytes>",
+		},
+		{
+			name: "Test an empty body",
+			body: "",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactBody([]byte(tt.body)); got != tt.want {
+				t.Errorf("redactBody() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_redactHeaders(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://artifactory/api/repositories", nil)
+	req.SetBasicAuth("admin", "password")
+	req.Header.Add("X-JFrog-Art-Api", "AKCp5")
+	req.Header.Add("Content-Type", "application/json")
+
+	got := redactHeaders(req.Header)
+	if got.Get("Authorization") != redacted || got.Get("X-JFrog-Art-Api") != redacted {
+		t.Errorf("redactHeaders() = %v, want the credentials redacted", got)
+	}
+	if got.Get("Content-Type") != "application/json" {
+		t.Errorf("redactHeaders() = %v, want the other headers kept", got)
+	}
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "Basic ") {
+		t.Errorf("request header = %v, want the request itself unchanged", req.Header.Get("Authorization"))
+	}
+}
+
+func TestClient_debugEnabled(t *testing.T) {
+	client := NewClient(&ClientConfig{BaseURL: "https://artifactory"})
+	if client.debugEnabled(context.TODO()) {
+		t.Error("debugEnabled() = true, want the debug log off by default")
+	}
+	if !client.debugEnabled(WithDebug(context.TODO())) {
+		t.Error("debugEnabled() = false, want it on for a debug context")
+	}
+	client.Config.Debug = true
+	if !client.debugEnabled(context.TODO()) {
+		t.Error("debugEnabled() = false, want it on for a debug client")
+	}
+}
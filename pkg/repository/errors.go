@@ -1,5 +1,25 @@
 package repository
 
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Errors returned by the client for the Artifactory responses callers have to tell apart.
+// They match an *APIError with the corresponding status code through errors.Is.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+)
+
+// ErrTokenExpired is returned for a request when the access token expired and couldn't be refreshed
+var ErrTokenExpired = errors.New("the access token expired")
+
 // ErrorsJSON : Struct
 type ErrorsJSON struct {
 	Errors []ErrorJSON `json:"errors,omitempty"`
@@ -8,6 +28,63 @@ type ErrorsJSON struct {
 
 // ErrorJSON : Struct
 type ErrorJSON struct {
-	Status  string `json:"status"`
+	Status  int    `json:"status"`
 	Message string `json:"message"`
 }
+
+// APIError : A non-2xx response from Artifactory with the messages of its error json
+type APIError struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *APIError) Error() string {
+	msg := "artifactory returned " + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+	if len(e.Messages) > 0 {
+		msg += ": " + strings.Join(e.Messages, "; ")
+	}
+	return msg
+}
+
+// Is matches the error with the typed error of its status code
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// CleanupError : Lists the Artifactory objects that could not be deleted during cleanup
+type CleanupError struct {
+	Failed map[string]error
+}
+
+func (e *CleanupError) Error() string {
+	keys := []string{}
+	for key := range e.Failed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	msgs := []string{}
+	for _, key := range keys {
+		msgs = append(msgs, key+": "+e.Failed[key].Error())
+	}
+	return "failed to delete " + strings.Join(msgs, "; ")
+}
+
+// AdoptionError : Reports an existing repository which can't be adopted
+type AdoptionError struct {
+	Key    string
+	Reason string
+}
+
+func (e *AdoptionError) Error() string {
+	return "cannot adopt repository " + e.Key + ": " + e.Reason
+}
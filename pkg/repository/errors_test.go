@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		code         int
+		body         string
+		wantState    string
+		wantErr      error
+		wantMessages []string
+	}{
+		{
+			name:      "Test a 2xx response is no error",
+			code:      http.StatusCreated,
+			body:      `{"key":"test-repo"}`,
+			wantState: statusOKState,
+		},
+		{
+			name:         "Test a 400 response is an error",
+			code:         http.StatusBadRequest,
+			body:         `{"errors":[{"status":400,"message":"Bad Request"}]}`,
+			wantState:    "Bad Request",
+			wantMessages: []string{"Bad Request"},
+		},
+		{
+			name:         "Test a 404 response is not found",
+			code:         http.StatusNotFound,
+			body:         `{"errors":[{"status":404,"message":"Permission target not found"}]}`,
+			wantState:    "Not Found",
+			wantErr:      ErrNotFound,
+			wantMessages: []string{"Permission target not found"},
+		},
+		{
+			name:         "Test a 401 response is unauthorized",
+			code:         http.StatusUnauthorized,
+			body:         `{"error":"Bad credentials"}`,
+			wantState:    "Unauthorized",
+			wantErr:      ErrUnauthorized,
+			wantMessages: []string{"Bad credentials"},
+		},
+		{
+			name:      "Test a 403 response is unauthorized",
+			code:      http.StatusForbidden,
+			wantState: "Forbidden",
+			wantErr:   ErrUnauthorized,
+		},
+		{
+			name:      "Test a 409 response is a conflict",
+			code:      http.StatusConflict,
+			wantState: conflictState,
+			wantErr:   ErrConflict,
+		},
+		{
+			name:         "Test a 429 response is rate limited",
+			code:         http.StatusTooManyRequests,
+			body:         "slow down",
+			wantState:    "Too Many Requests",
+			wantErr:      ErrRateLimited,
+			wantMessages: []string{"slow down"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Response{StatusCode: tt.code, Body: ioutil.NopCloser(strings.NewReader(tt.body))}
+			data, code, state, err := parseResponse(r)
+			if string(data) != tt.body || code != tt.code || state != tt.wantState {
+				t.Errorf("parseResponse() = %q, %v, %q, want %q, %v, %q", data, code, state, tt.body, tt.code, tt.wantState)
+			}
+			if tt.code < 300 {
+				if err != nil {
+					t.Errorf("parseResponse() error = %v, want nil", err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("parseResponse() error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.code || !reflect.DeepEqual(apiErr.Messages, tt.wantMessages) {
+				t.Errorf("parseResponse() error = %#v, want code %v and messages %v", apiErr, tt.code, tt.wantMessages)
+			}
+			for _, target := range []error{ErrNotFound, ErrUnauthorized, ErrConflict, ErrRateLimited} {
+				if errors.Is(err, target) != (target == tt.wantErr) {
+					t.Errorf("errors.Is(%v, %v) = %v", err, target, !(target == tt.wantErr))
+				}
+			}
+		})
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	err := fmt.Errorf("get user: %w", &APIError{StatusCode: http.StatusNotFound, Messages: []string{"User test not found"}})
+	want := "get user: artifactory returned 404 Not Found: User test not found"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("errors.Is(%v, ErrNotFound) = false", err)
+	}
+}
+
+func TestGetMissingRepositoryIsNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"errors":[{"status":400,"message":"Bad Request"}]}`)
+	}))
+	defer server.Close()
+	client := NewClient(&ClientConfig{BaseURL: server.URL, Username: "username", Password: "password"})
+	R := RTFactory{}
+
+	if _, _, _, err := R.GetLocalRepo(context.TODO(), &client, "missing-repo-local", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetLocalRepo() error = %v, want ErrNotFound", err)
+	}
+	if _, _, _, err := R.GetVirtualRepo(context.TODO(), &client, "missing-repo", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetVirtualRepo() error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EventRecorder receives the changes the client made in Artifactory, so that they can be
+// reported on the object which requested them
+type EventRecorder interface {
+	Eventf(eventtype, reason, messageFmt string, args ...interface{})
+}
+
+// Reasons of the events recorded by the client
+const (
+	EventReasonRepositoryCreated        = "RepositoryCreated"
+	EventReasonRepositoryAdopted        = "RepositoryAdopted"
+	EventReasonVirtualRepositoryCreated = "VirtualRepositoryCreated"
+	EventReasonPermissionTargetCreated  = "PermissionTargetCreated"
+	EventReasonPermissionTargetUpdated  = "PermissionTargetUpdated"
+	EventReasonPermissionTargetFailed   = "PermissionTargetFailed"
+)
+
+// Record a normal event, the recorder is optional
+func recordEvent(recorder EventRecorder, reason string, messageFmt string, args ...interface{}) {
+	if recorder != nil {
+		recorder.Eventf(corev1.EventTypeNormal, reason, messageFmt, args...)
+	}
+}
+
+// Record a warning event, the recorder is optional
+func recordWarning(recorder EventRecorder, reason string, messageFmt string, args ...interface{}) {
+	if recorder != nil {
+		recorder.Eventf(corev1.EventTypeWarning, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// GroupDetails represents the details of a group in artifactory
+type GroupDetails struct {
+	Name            string `json:"name,omitempty"`
+	Description     string `json:"description,omitempty"`
+	AutoJoin        bool   `json:"autoJoin"`
+	AdminPrivileges bool   `json:"adminPrivileges"`
+	Realm           string `json:"realm,omitempty"`
+}
+
+// CreateGroup creates or replaces a group with the specified details
+func (R RTFactory) CreateGroup(ctx context.Context, c *Client, key string, g GroupDetails, q map[string]string) (int, string, error) {
+	j, err := json.Marshal(g)
+	if err != nil {
+		return 500, statusInternalServerErrorState, err
+	}
+	_, code, status, err := Put(ctx, c, "/api/security/groups/"+key, j, q)
+	return code, status, err
+}
+
+// DeleteGroup deletes a group
+func (R RTFactory) DeleteGroup(ctx context.Context, c *Client, key string) (int, string, error) {
+	return Delete(ctx, c, "/api/security/groups/"+key)
+}
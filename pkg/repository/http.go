@@ -2,19 +2,34 @@ package repository
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
+	"time"
 )
 
-var statusCodeStateList = make(map[int]string)
+// State reported for the status codes returned by Artifactory, other codes use their http status text
+var statusCodeStateList = map[int]string{
+	http.StatusOK:                  statusOKState,
+	http.StatusCreated:             statusOKState,
+	http.StatusNoContent:           statusOKState,
+	http.StatusConflict:            conflictState,
+	http.StatusInternalServerError: statusInternalServerErrorState,
+}
+
+// State for a status code
+func statusState(code int) string {
+	if state, ok := statusCodeStateList[code]; ok {
+		return state
+	}
+	return http.StatusText(code)
+}
 
 // Request represents an artifactory http request
 type Request struct {
@@ -27,8 +42,8 @@ type Request struct {
 }
 
 // Get performs an http GET to artifactory
-func Get(c *Client, path string, options map[string]string) ([]byte, int, string, error) {
-	r, err := makeRequest(c, "GET", path, options, nil)
+func Get(ctx context.Context, c *Client, path string, options map[string]string) ([]byte, int, string, error) {
+	r, err := makeRequest(ctx, c, "GET", path, options, nil)
 	if err != nil {
 		var data bytes.Buffer
 		return data.Bytes(), 500, statusInternalServerErrorState, err
@@ -38,9 +53,21 @@ func Get(c *Client, path string, options map[string]string) ([]byte, int, string
 }
 
 // Put performs an http PUT to artifactory
-func Put(c *Client, path string, data []byte, options map[string]string) ([]byte, int, string, error) {
+func Put(ctx context.Context, c *Client, path string, data []byte, options map[string]string) ([]byte, int, string, error) {
+	body := bytes.NewReader(data)
+	r, err := makeRequest(ctx, c, "PUT", path, options, body)
+	if err != nil {
+		var data bytes.Buffer
+		return data.Bytes(), 500, statusInternalServerErrorState, err
+	}
+
+	return parseResponse(r)
+}
+
+// Post performs an http POST to artifactory
+func Post(ctx context.Context, c *Client, path string, data []byte, options map[string]string) ([]byte, int, string, error) {
 	body := bytes.NewReader(data)
-	r, err := makeRequest(c, "PUT", path, options, body)
+	r, err := makeRequest(ctx, c, "POST", path, options, body)
 	if err != nil {
 		var data bytes.Buffer
 		return data.Bytes(), 500, statusInternalServerErrorState, err
@@ -50,25 +77,22 @@ func Put(c *Client, path string, data []byte, options map[string]string) ([]byte
 }
 
 // Delete performs an http DELETE to artifactory
-func Delete(c *Client, path string) (int, string, error) {
-	var code = 200
-	r, err := makeRequest(c, "DELETE", path, make(map[string]string), nil)
+func Delete(ctx context.Context, c *Client, path string) (int, string, error) {
+	r, err := makeRequest(ctx, c, "DELETE", path, make(map[string]string), nil)
 	if err != nil {
-		code = 500
-		return code, statusInternalServerErrorState, err
+		return 500, statusInternalServerErrorState, err
 	}
-	_, _, _, err = parseResponse(r)
+	_, code, state, err := parseResponse(r)
 
-	return code, statusOKState, err
+	return code, state, err
 }
 
-func makeRequest(c *Client, method string, path string, options map[string]string, body io.Reader) (*http.Response, error) {
+func makeRequest(ctx context.Context, c *Client, method string, path string, options map[string]string, body io.Reader) (*http.Response, error) {
 	qs := url.Values{}
 	var contentType string
 	for q, p := range options {
 		if q == "content-type" {
 			contentType = p
-			delete(options, q)
 		} else {
 			qs.Add(q, p)
 		}
@@ -79,14 +103,17 @@ func makeRequest(c *Client, method string, path string, options map[string]strin
 	if err != nil {
 		return nil, err
 	}
-	if len(options) != 0 {
+	if len(qs) != 0 {
 		u.RawQuery = qs.Encode()
 	}
 	buf := new(bytes.Buffer)
 	if body != nil {
 		_, _ = buf.ReadFrom(body)
 	}
-	req, _ := http.NewRequest(method, u.String(), bytes.NewReader(buf.Bytes()))
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
 	if body != nil {
 		h := sha1.New()
 		_, _ = h.Write(buf.Bytes())
@@ -100,19 +127,33 @@ func makeRequest(c *Client, method string, path string, options map[string]strin
 	} else {
 		req.Header.Add("Content-Type", "application/json")
 	}
-	if c.Config.AuthMethod == "basic" {
+	switch {
+	case c.Config.AuthMethod == AuthMethodBasic:
 		req.SetBasicAuth(c.Config.Username, c.Config.Password)
-	} else {
+	case c.tokens != nil:
+		token, err := c.tokens.token(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Authorization", "Bearer "+token)
+	default:
 		req.Header.Add("X-JFrog-Art-Api", c.Config.Token)
 	}
-	if os.Getenv("REPOSITORY_DEBUG") != "" {
-		log.Info("Headers: %#v", req.Header)
-		if len(buf.Bytes()) > 0 {
-			log.Info("Body: %#v", buf.String())
-		}
+	debug := c.debugEnabled(ctx)
+	if debug {
+		logRequest(req, buf.Bytes())
 	}
 
+	start := time.Now()
 	r, err := c.Client.Do(req)
+	code := 0
+	if err == nil {
+		code = r.StatusCode
+	}
+	observeRequest(method, path, code, start)
+	if debug {
+		logResponse(req, code, start, err)
+	}
 
 	return r, err
 }
@@ -120,22 +161,28 @@ func makeRequest(c *Client, method string, path string, options map[string]strin
 func parseResponse(r *http.Response) ([]byte, int, string, error) {
 	defer func() { _ = r.Body.Close() }()
 	data, err := ioutil.ReadAll(r.Body)
-	if (r.StatusCode < 200 || r.StatusCode > 299) && r.StatusCode != 400 {
-		var ej ErrorsJSON
-		uerr := json.Unmarshal(data, &ej)
-		if uerr != nil {
-			emsg := fmt.Sprintf("Unable to parse error json. Non-2xx code returned: %d. Message follows:\n%s", r.StatusCode, string(data))
-			return data, r.StatusCode, statusCodeStateList[r.StatusCode], errors.New(emsg)
-		}
-		// here we catch the {"error":"foo"} oddity in things like security/apiKey
-		if ej.Error != "" {
-			return data, r.StatusCode, statusCodeStateList[r.StatusCode], errors.New(ej.Error)
-		}
-		var emsgs []string
-		for _, i := range ej.Errors {
-			emsgs = append(emsgs, i.Message)
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return data, r.StatusCode, statusState(r.StatusCode), newAPIError(r.StatusCode, data)
+	}
+	return data, r.StatusCode, statusState(r.StatusCode), err
+}
+
+// Create the error for a non-2xx response from the error json in its body
+func newAPIError(code int, data []byte) *APIError {
+	apiErr := &APIError{StatusCode: code}
+	var ej ErrorsJSON
+	if uerr := json.Unmarshal(data, &ej); uerr != nil {
+		if len(data) > 0 {
+			apiErr.Messages = []string{string(data)}
 		}
-		return data, r.StatusCode, statusCodeStateList[r.StatusCode], errors.New(strings.Join(emsgs, "\n"))
+		return apiErr
+	}
+	// here we catch the {"error":"foo"} oddity in things like security/apiKey
+	if ej.Error != "" {
+		apiErr.Messages = []string{ej.Error}
+	}
+	for _, i := range ej.Errors {
+		apiErr.Messages = append(apiErr.Messages, i.Message)
 	}
-	return data, r.StatusCode, statusCodeStateList[r.StatusCode], err
+	return apiErr
 }
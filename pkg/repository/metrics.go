@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// requestsTotal counts the Artifactory API calls by endpoint, method and status code
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "repo_operator_artifactory_requests_total",
+			Help: "Number of Artifactory API requests by endpoint, method and status code.",
+		},
+		[]string{"endpoint", "method", "code"},
+	)
+	// requestDuration observes the latency of the Artifactory API calls by endpoint and method
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "repo_operator_artifactory_request_duration_seconds",
+			Help:    "Latency of Artifactory API requests by endpoint and method.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"endpoint", "method"},
+	)
+	// retriesTotal counts the retried Artifactory API calls by endpoint and method
+	retriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "repo_operator_artifactory_retries_total",
+			Help: "Number of retried Artifactory API requests by endpoint and method.",
+		},
+		[]string{"endpoint", "method"},
+	)
+)
+
+// Endpoints which are addressed with the key of an object, the key is left out of the endpoint label
+var keyedEndpoints = []string{
+	"/api/repositories/",
+	"/api/security/users/",
+	"/api/security/permissions/",
+	"/api/security/groups/",
+}
+
+func init() {
+	metrics.Registry.MustRegister(requestsTotal, requestDuration, retriesTotal)
+}
+
+// Record an Artifactory request, a request which got no response is counted with the code "error"
+func observeRequest(method string, path string, code int, start time.Time) {
+	endpoint := endpointLabel(path)
+	codeLabel := "error"
+	if code != 0 {
+		codeLabel = strconv.Itoa(code)
+	}
+	requestsTotal.WithLabelValues(endpoint, method, codeLabel).Inc()
+	requestDuration.WithLabelValues(endpoint, method).Observe(time.Since(start).Seconds())
+}
+
+// Endpoint label of a request path, e.g. /api/repositories/{key}. The path may still carry the
+// context path of the Artifactory base URL.
+func endpointLabel(path string) string {
+	for _, prefix := range keyedEndpoints {
+		if strings.Contains(path, prefix) {
+			return prefix + "{key}"
+		}
+	}
+	return path
+}
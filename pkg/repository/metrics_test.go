@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_endpointLabel(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/api/repositories", want: "/api/repositories"},
+		{path: "/api/repositories/test-repo-npm-local", want: "/api/repositories/{key}"},
+		{path: "/api/security/users/test-repo-user", want: "/api/security/users/{key}"},
+		{path: "/api/security/groups/test-repo-group", want: "/api/security/groups/{key}"},
+		{path: "/api/security/permissions/test-repo-npm-repo-permission", want: "/api/security/permissions/{key}"},
+		{path: "/artifactory/api/repositories/test-repo-npm", want: "/api/repositories/{key}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := endpointLabel(tt.path); got != tt.want {
+				t.Errorf("endpointLabel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsAreCounted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer server.Close()
+
+	transport := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(server.URL)
+		},
+	}
+	client := NewClient(&ClientConfig{
+		BaseURL:   "http://127.0.0.1:8080/",
+		Username:  "username",
+		Password:  "password",
+		Transport: transport,
+	})
+
+	counter := requestsTotal.WithLabelValues("/api/repositories/{key}", "DELETE", "404")
+	before := testutil.ToFloat64(counter)
+	_, _, _ = Delete(context.TODO(), &client, "/api/repositories/test-repo-npm-local")
+	if got := testutil.ToFloat64(counter); got != before+1 {
+		t.Errorf("requests counted = %v, want %v", got, before+1)
+	}
+}
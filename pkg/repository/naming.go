@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+)
+
+// Placeholders in the naming templates
+const (
+	NamePlaceholder     = "{name}"
+	RepotypePlaceholder = "{repotype}"
+)
+
+// Naming holds the templates for the names of the Artifactory objects created for a Repository.
+// An empty template uses the default one.
+type Naming struct {
+	// User is the template for the name of the repository user, it must contain {name}
+	User string
+	// PermissionTarget is the template for the name of the permission target, it must contain {name} and {repotype}
+	PermissionTarget string
+	// Group is the template for the name of the group the access tokens of a repository are scoped to, it must contain {name}
+	Group string
+}
+
+// DefaultNaming are the names used when no templates are configured
+var DefaultNaming = Naming{
+	User:             NamePlaceholder + suffixArtifactoryRepoUser,
+	PermissionTarget: NamePlaceholder + "-" + RepotypePlaceholder + suffixArtifactoryRepoPermission,
+	Group:            NamePlaceholder + suffixArtifactoryRepoGroup,
+}
+
+// UserName returns the name of the repository user for a request
+func (n Naming) UserName(reqName string) string {
+	return render(orDefault(n.User, DefaultNaming.User), reqName, "")
+}
+
+// PermissionTargetName returns the name of the permission target for a request and repotype
+func (n Naming) PermissionTargetName(reqName string, repoType string) string {
+	return render(orDefault(n.PermissionTarget, DefaultNaming.PermissionTarget), reqName, repoType)
+}
+
+// GroupName returns the name of the group the access tokens of a request are scoped to
+func (n Naming) GroupName(reqName string) string {
+	return render(orDefault(n.Group, DefaultNaming.Group), reqName, "")
+}
+
+// Validate checks that the templates keep the names of different requests apart
+func (n Naming) Validate() error {
+	if n.User != "" && !strings.Contains(n.User, NamePlaceholder) {
+		return errors.New("the user name template must contain " + NamePlaceholder)
+	}
+	if n.PermissionTarget != "" && (!strings.Contains(n.PermissionTarget, NamePlaceholder) || !strings.Contains(n.PermissionTarget, RepotypePlaceholder)) {
+		return errors.New("the permission target name template must contain " + NamePlaceholder + " and " + RepotypePlaceholder)
+	}
+	if n.Group != "" && !strings.Contains(n.Group, NamePlaceholder) {
+		return errors.New("the group name template must contain " + NamePlaceholder)
+	}
+	return nil
+}
+
+// Fill in the placeholders of a template
+func render(template string, reqName string, repoType string) string {
+	return strings.NewReplacer(NamePlaceholder, reqName, RepotypePlaceholder, repoType).Replace(template)
+}
+
+func orDefault(value string, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"testing"
+)
+
+func TestNaming(t *testing.T) {
+	tests := []struct {
+		name           string
+		naming         Naming
+		wantUser       string
+		wantPermission string
+		wantGroup      string
+		wantErr        bool
+	}{
+		{
+			name:           "Test empty templates use the default names",
+			wantUser:       "test-repo-user",
+			wantPermission: "test-docker-repo-permission",
+			wantGroup:      "test-repo-group",
+		},
+		{
+			name:           "Test templates are rendered",
+			naming:         Naming{User: "svc-{name}", PermissionTarget: "{repotype}-{name}", Group: "grp-{name}"},
+			wantUser:       "svc-test",
+			wantPermission: "docker-test",
+			wantGroup:      "grp-test",
+		},
+		{
+			name:    "Test a user template without the name is rejected",
+			naming:  Naming{User: "svc-user"},
+			wantErr: true,
+		},
+		{
+			name:    "Test a permission target template without the repotype is rejected",
+			naming:  Naming{PermissionTarget: "{name}-permission"},
+			wantErr: true,
+		},
+		{
+			name:    "Test a group template without the name is rejected",
+			naming:  Naming{Group: "docker-pullers"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.naming.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tt.naming.UserName("test"); got != tt.wantUser {
+				t.Errorf("UserName() = %v, want %v", got, tt.wantUser)
+			}
+			if got := tt.naming.PermissionTargetName("test", "docker"); got != tt.wantPermission {
+				t.Errorf("PermissionTargetName() = %v, want %v", got, tt.wantPermission)
+			}
+			if got := tt.naming.GroupName("test"); got != tt.wantGroup {
+				t.Errorf("GroupName() = %v, want %v", got, tt.wantGroup)
+			}
+		})
+	}
+}
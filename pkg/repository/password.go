@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Character classes of the generated passwords
+const (
+	passwordUpper  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	passwordLower  = "abcdefghijklmnopqrstuvwxyz"
+	passwordDigits = "0123456789"
+	// DefaultPasswordSpecials are special characters which are safe unquoted in a shell and in a docker config
+	DefaultPasswordSpecials = "-_.~+=^%@"
+)
+
+// Characters which break the docker config json, the user:password docker auth or shell scripts
+const unsafePasswordCharacters = "\"'\\`$:; \t\r\n"
+
+// MinPasswordLength is the shortest password a policy may ask for
+const MinPasswordLength = 12
+
+// PasswordPolicy describes the passwords generated for the repository users. An empty policy uses the
+// DefaultPasswordPolicy.
+type PasswordPolicy struct {
+	// Length of the password
+	Length int
+	// MinUpper, MinLower, MinDigits and MinSpecial are the least number of characters of each class
+	MinUpper   int
+	MinLower   int
+	MinDigits  int
+	MinSpecial int
+	// Specials are the special characters to use, empty uses the DefaultPasswordSpecials
+	Specials string
+	// Exclude are characters which are never used, e.g. ones which are easily confused
+	Exclude string
+}
+
+// DefaultPasswordPolicy is the policy used when none is configured
+var DefaultPasswordPolicy = PasswordPolicy{Length: 24, MinUpper: 1, MinLower: 1, MinDigits: 1, MinSpecial: 1}
+
+func (p PasswordPolicy) orDefault() PasswordPolicy {
+	if p == (PasswordPolicy{}) {
+		p = DefaultPasswordPolicy
+	}
+	if p.Specials == "" {
+		p.Specials = DefaultPasswordSpecials
+	}
+	return p
+}
+
+// The characters of a class which aren't excluded
+func (p PasswordPolicy) class(chars string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(p.Exclude, r) {
+			return -1
+		}
+		return r
+	}, chars)
+}
+
+// Validate checks that passwords can be generated with the policy and that they're long enough
+func (p PasswordPolicy) Validate() error {
+	p = p.orDefault()
+	if p.Length < MinPasswordLength {
+		return fmt.Errorf("the password length must be at least %d", MinPasswordLength)
+	}
+	if p.MinUpper < 0 || p.MinLower < 0 || p.MinDigits < 0 || p.MinSpecial < 0 {
+		return errors.New("the least number of characters of a class must not be negative")
+	}
+	if p.MinUpper+p.MinLower+p.MinDigits+p.MinSpecial > p.Length {
+		return errors.New("the least numbers of characters of the classes add up to more than the password length")
+	}
+	if strings.ContainsAny(p.Specials, unsafePasswordCharacters) {
+		return fmt.Errorf("the special characters must not contain any of %q", unsafePasswordCharacters)
+	}
+	for _, s := range p.Specials {
+		if s > 126 || s < 33 || strings.ContainsRune(passwordUpper+passwordLower+passwordDigits, s) {
+			return fmt.Errorf("the special characters must be printable ascii punctuation, %q isn't", s)
+		}
+	}
+	classes := []struct {
+		name  string
+		chars string
+		min   int
+	}{
+		{"upper case letters", passwordUpper, p.MinUpper},
+		{"lower case letters", passwordLower, p.MinLower},
+		{"digits", passwordDigits, p.MinDigits},
+		{"special characters", p.Specials, p.MinSpecial},
+	}
+	all := ""
+	for _, c := range classes {
+		chars := p.class(c.chars)
+		if c.min > 0 && chars == "" {
+			return fmt.Errorf("every one of the %s is excluded", c.name)
+		}
+		all += chars
+	}
+	if all == "" {
+		return errors.New("every character is excluded")
+	}
+	return nil
+}
+
+// Generate returns a password which complies with the policy, drawn from crypto/rand
+func (p PasswordPolicy) Generate() (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	p = p.orDefault()
+	upper, lower, digits, specials := p.class(passwordUpper), p.class(passwordLower), p.class(passwordDigits), p.class(p.Specials)
+	buf := make([]byte, 0, p.Length)
+	for _, c := range []struct {
+		chars string
+		min   int
+	}{{upper, p.MinUpper}, {lower, p.MinLower}, {digits, p.MinDigits}, {specials, p.MinSpecial}} {
+		for i := 0; i < c.min; i++ {
+			b, err := randomChar(c.chars)
+			if err != nil {
+				return "", err
+			}
+			buf = append(buf, b)
+		}
+	}
+	all := upper + lower + digits + specials
+	for len(buf) < p.Length {
+		b, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		buf = append(buf, b)
+	}
+	// Shuffle, so that the required characters aren't always at the start
+	for i := len(buf) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf), nil
+}
+
+func randomChar(chars string) (byte, error) {
+	i, err := randomInt(len(chars))
+	if err != nil {
+		return 0, err
+	}
+	return chars[i], nil
+}
+
+// Uniform random number in [0, n) from crypto/rand
+func randomInt(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("generating a password: %w", err)
+	}
+	return int(i.Int64()), nil
+}
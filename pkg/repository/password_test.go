@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Count the characters of the password in the class
+func countIn(password string, chars string) int {
+	n := 0
+	for _, r := range password {
+		if strings.ContainsRune(chars, r) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPasswordPolicy_Generate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy PasswordPolicy
+	}{
+		{name: "Test the default policy", policy: PasswordPolicy{}},
+		{name: "Test a long policy with many required characters", policy: PasswordPolicy{Length: 40, MinUpper: 5, MinLower: 5, MinDigits: 10, MinSpecial: 10}},
+		{name: "Test excluded characters", policy: PasswordPolicy{Length: 16, MinUpper: 2, MinDigits: 2, Specials: "-_", MinSpecial: 1, Exclude: "O0Il1"}},
+		{name: "Test the required characters fill the password", policy: PasswordPolicy{Length: 12, MinUpper: 3, MinLower: 3, MinDigits: 3, MinSpecial: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy.orDefault()
+			for i := 0; i < 200; i++ {
+				password, err := tt.policy.Generate()
+				if err != nil {
+					t.Fatalf("Generate() error = %v", err)
+				}
+				if len(password) != policy.Length {
+					t.Fatalf("Generate() = %q, want %d characters", password, policy.Length)
+				}
+				if countIn(password, passwordUpper) < policy.MinUpper || countIn(password, passwordLower) < policy.MinLower ||
+					countIn(password, passwordDigits) < policy.MinDigits || countIn(password, policy.Specials) < policy.MinSpecial {
+					t.Fatalf("Generate() = %q, doesn't have the required characters of %+v", password, policy)
+				}
+				if countIn(password, passwordUpper+passwordLower+passwordDigits+policy.Specials) != len(password) {
+					t.Fatalf("Generate() = %q, has characters outside the policy", password)
+				}
+				if strings.ContainsAny(password, policy.Exclude) || strings.ContainsAny(password, unsafePasswordCharacters) {
+					t.Fatalf("Generate() = %q, has excluded or unsafe characters", password)
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy_GenerateIsUnique(t *testing.T) {
+	// Passwords generated at the same time, e.g. by concurrent reconciles, must differ
+	const workers, perWorker = 8, 250
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[string]bool{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				password, err := DefaultPasswordPolicy.Generate()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				seen[password] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != workers*perWorker {
+		t.Errorf("generated %d distinct passwords, want %d", len(seen), workers*perWorker)
+	}
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  PasswordPolicy
+		wantErr string
+	}{
+		{name: "Test the default policy is valid", policy: PasswordPolicy{}},
+		{name: "Test short passwords are rejected", policy: PasswordPolicy{Length: 8}, wantErr: "at least 12"},
+		{name: "Test the required characters must fit", policy: PasswordPolicy{Length: 12, MinDigits: 10, MinSpecial: 3}, wantErr: "add up"},
+		{name: "Test negative minimums are rejected", policy: PasswordPolicy{Length: 12, MinUpper: -1}, wantErr: "negative"},
+		{name: "Test quotes break the docker config", policy: PasswordPolicy{Length: 12, Specials: `-"`}, wantErr: "must not contain"},
+		{name: "Test a dollar breaks shells", policy: PasswordPolicy{Length: 12, Specials: "$"}, wantErr: "must not contain"},
+		{name: "Test letters aren't special characters", policy: PasswordPolicy{Length: 12, Specials: "-a"}, wantErr: "punctuation"},
+		{name: "Test a required class must not be excluded", policy: PasswordPolicy{Length: 12, MinDigits: 1, Exclude: passwordDigits}, wantErr: "digits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() = %v, want nil", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
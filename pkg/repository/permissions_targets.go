@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"encoding/json"
 )
 
@@ -26,9 +27,9 @@ type Principals struct {
 }
 
 // GetPermissionTargetDetails : get details about the permission target
-func (R RTFactory) GetPermissionTargetDetails(c *Client, key string, q map[string]string) (PermissionTargetDetails, int, string, error) {
+func (R RTFactory) GetPermissionTargetDetails(ctx context.Context, c *Client, key string, q map[string]string) (PermissionTargetDetails, int, string, error) {
 	var res PermissionTargetDetails
-	permission, code, status, err := Get(c, "/api/security/permissions/"+key, q)
+	permission, code, status, err := Get(ctx, c, "/api/security/permissions/"+key, q)
 	if err != nil {
 		return res, 500, statusInternalServerErrorState, err
 	}
@@ -37,20 +38,20 @@ func (R RTFactory) GetPermissionTargetDetails(c *Client, key string, q map[strin
 }
 
 // CreatePermissionTarget creates the named permission target
-func (R RTFactory) CreatePermissionTarget(c *Client, key string, p PermissionTargetDetails, q map[string]string) (int, string, error) {
+func (R RTFactory) CreatePermissionTarget(ctx context.Context, c *Client, key string, p PermissionTargetDetails, q map[string]string) (int, string, error) {
 	j, err := json.Marshal(p)
 	if err != nil {
 		return 500, statusInternalServerErrorState, err
 	}
-	_, code, status, err := Put(c, "/api/security/permissions/"+key, j, q)
+	_, code, status, err := Put(ctx, c, "/api/security/permissions/"+key, j, q)
 	return code, status, err
 }
 
 // DeletePermissionTarget : Delete permission target
-func (R RTFactory) DeletePermissionTarget(c *Client, key string) (int, string, error) {
+func (R RTFactory) DeletePermissionTarget(ctx context.Context, c *Client, key string) (int, string, error) {
 	var err error
 	code := 0
 	status := ""
-	code, status, err = Delete(c, "/api/security/permissions/"+key)
+	code, status, err = Delete(ctx, c, "/api/security/permissions/"+key)
 	return code, status, err
 }
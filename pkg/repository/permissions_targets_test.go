@@ -2,6 +2,7 @@ package repository
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -82,7 +83,7 @@ func TestClient_CreatePermissionTarget(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			code, status, err := client.rt.CreatePermissionTarget(&client, tt.args.key, tt.args.p, tt.args.q)
+			code, status, err := client.rt.CreatePermissionTarget(context.TODO(), &client, tt.args.key, tt.args.p, tt.args.q)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreatePermissionTarget() returned error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -147,7 +148,7 @@ func TestClient_DeletePermissionTarget(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, _, err := client.rt.DeletePermissionTarget(&client, tt.args.key)
+			_, _, err := client.rt.DeletePermissionTarget(context.TODO(), &client, tt.args.key)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeletePermissionTarget() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -221,7 +222,7 @@ func TestClient_GetPermissionTargetDetails(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			pt, _, _, err := client.rt.GetPermissionTargetDetails(&client, tt.args.key, tt.args.q)
+			pt, _, _, err := client.rt.GetPermissionTargetDetails(context.TODO(), &client, tt.args.key, tt.args.q)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetPermissionTargetDetails() error = %v, wantErr %v", err, tt.wantErr)
 				return
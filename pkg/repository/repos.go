@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 )
 
 // Repo represents the json response from Artifactory describing a repository
@@ -69,6 +73,21 @@ func (r LocalRepoConfig) MimeType() string {
 	return LocalRepoMimeType
 }
 
+// localRepoPatch is the update of the local repository settings the drift check corrects. The xray index is
+// always sent, LocalRepoConfig leaves out a false one and the indexing wouldn't be turned off.
+type localRepoPatch struct {
+	Key             string `json:"key,omitempty"`
+	RClass          string `json:"rclass"`
+	HandleReleases  *bool  `json:"handleReleases,omitempty"`
+	HandleSnapshots *bool  `json:"handleSnapshots,omitempty"`
+	XrayIndex       bool   `json:"xrayIndex"`
+}
+
+// MimeType returns the MimeType for a local repo in artifactory
+func (r localRepoPatch) MimeType() string {
+	return LocalRepoMimeType
+}
+
 // RemoteRepoConfig represents a remote repo in artifactory
 type RemoteRepoConfig struct {
 	GenericRepoConfig
@@ -125,13 +144,13 @@ func (r VirtualRepoConfig) MimeType() string {
 }
 
 // GetRemoteRepos returns all repos of the provided type
-func (R RTFactory) GetRemoteRepos(c *Client, packageType string) ([]RemoteRepo, int, string, error) {
+func (R RTFactory) GetRemoteRepos(ctx context.Context, c *Client, packageType string) ([]RemoteRepo, int, string, error) {
 	o := make(map[string]string)
 	cd := 0
 	o["type"] = "remote"
 	o["packageType"] = packageType
 	var dat []RemoteRepo
-	d, cd, status, err := Get(c, "/api/repositories", o)
+	d, cd, status, err := Get(ctx, c, "/api/repositories", o)
 	if err != nil {
 		return dat, 500, statusInternalServerErrorState, err
 	}
@@ -142,12 +161,21 @@ func (R RTFactory) GetRemoteRepos(c *Client, packageType string) ([]RemoteRepo,
 	return dat, cd, status, err
 }
 
+// Artifactory answers 400 instead of 404 for a repository key which doesn't exist
+func repoNotFound(key string, err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("repository %s: %w", key, ErrNotFound)
+	}
+	return err
+}
+
 // GetLocalRepo returns the named local repo
-func (R RTFactory) GetLocalRepo(c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+func (R RTFactory) GetLocalRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
 	var dat GenericRepoConfig
-	d, code, status, err := Get(c, "/api/repositories/"+key, q)
+	d, code, status, err := Get(ctx, c, "/api/repositories/"+key, q)
 	if err != nil {
-		return dat, 500, statusInternalServerErrorState, err
+		return dat, code, status, repoNotFound(key, err)
 	}
 	err = json.Unmarshal(d, &dat)
 	if err != nil {
@@ -159,11 +187,11 @@ func (R RTFactory) GetLocalRepo(c *Client, key string, q map[string]string) (Rep
 }
 
 // GetLocalRepo returns the named local repo
-func (R RTFactory) GetVirtualRepo(c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
+func (R RTFactory) GetVirtualRepo(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryConfig, int, string, error) {
 	var dat GenericRepoConfig
-	d, code, status, err := Get(c, "/api/repositories/"+key, q)
+	d, code, status, err := Get(ctx, c, "/api/repositories/"+key, q)
 	if err != nil {
-		return dat, 500, statusInternalServerErrorState, err
+		return dat, code, status, repoNotFound(key, err)
 	}
 	err = json.Unmarshal(d, &dat)
 	if err != nil {
@@ -175,22 +203,32 @@ func (R RTFactory) GetVirtualRepo(c *Client, key string, q map[string]string) (R
 }
 
 // CreateRepo creates the named repo
-func (R RTFactory) CreateRepo(c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
+func (R RTFactory) CreateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
 	code := 0
 	status := ""
 	j, err := json.Marshal(r)
 	if err != nil {
 		return 500, statusInternalServerErrorState, err
 	}
-	_, code, status, err = Put(c, "/api/repositories/"+key, j, q)
+	_, code, status, err = Put(ctx, c, "/api/repositories/"+key, j, q)
+	return code, status, err
+}
+
+// UpdateRepo updates the configuration of the named repo, only the fields set in the config are changed
+func (R RTFactory) UpdateRepo(ctx context.Context, c *Client, key string, r RepositoryConfig, q map[string]string) (int, string, error) {
+	j, err := json.Marshal(r)
+	if err != nil {
+		return 500, statusInternalServerErrorState, err
+	}
+	_, code, status, err := Post(ctx, c, "/api/repositories/"+key, j, q)
 	return code, status, err
 }
 
 // DeleteRepo creates the named repo
-func (R RTFactory) DeleteRepo(c *Client, key string) (int, string, error) {
+func (R RTFactory) DeleteRepo(ctx context.Context, c *Client, key string) (int, string, error) {
 	var err error
 	code := 0
 	status := ""
-	code, status, err = Delete(c, "/api/repositories/"+key)
+	code, status, err = Delete(ctx, c, "/api/repositories/"+key)
 	return code, status, err
 }
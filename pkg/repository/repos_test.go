@@ -2,6 +2,7 @@ package repository
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -78,7 +79,7 @@ func TestRTFactory_GetLocalRepo(t *testing.T) {
 			R := RTFactory{
 				rtInterface: tt.fields.rtInterface,
 			}
-			_, _, _, err := R.GetLocalRepo(&client, tt.args.key, tt.args.q)
+			_, _, _, err := R.GetLocalRepo(context.TODO(), &client, tt.args.key, tt.args.q)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetLocalRepo() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -154,7 +155,7 @@ func TestRTFactory_GetVirtualRepo(t *testing.T) {
 			R := RTFactory{
 				rtInterface: tt.fields.rtInterface,
 			}
-			_, _, _, err := R.GetVirtualRepo(&client, tt.args.key, tt.args.q)
+			_, _, _, err := R.GetVirtualRepo(context.TODO(), &client, tt.args.key, tt.args.q)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetLocalRepo() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -230,7 +231,7 @@ func TestRTFactory_GetRemoteRepos(t *testing.T) {
 			R := RTFactory{
 				rtInterface: tt.fields.rtInterface,
 			}
-			got, _, _, err := R.GetRemoteRepos(&client, tt.args.packageType)
+			got, _, _, err := R.GetRemoteRepos(context.TODO(), &client, tt.args.packageType)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetRemoteRepos() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -327,7 +328,7 @@ func TestRTFactory_CreateRepo(t *testing.T) {
 			R := RTFactory{
 				rtInterface: tt.fields.rtInterface,
 			}
-			_, _, err := R.CreateRepo(&client, tt.args.key, tt.args.r, tt.args.q)
+			_, _, err := R.CreateRepo(context.TODO(), &client, tt.args.key, tt.args.r, tt.args.q)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("CreateRepo() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -336,6 +337,50 @@ func TestRTFactory_CreateRepo(t *testing.T) {
 	}
 }
 
+func TestRTFactory_UpdateRepo(t *testing.T) {
+	var method string
+	var buf bytes.Buffer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		req, _ := ioutil.ReadAll(r.Body)
+		buf.Write(req)
+		w.WriteHeader(200)
+		_, err := fmt.Fprintf(w, "")
+		if err != nil {
+			t.Error("Failed to setup server")
+		}
+	}))
+	defer server.Close()
+
+	transport := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(server.URL)
+		},
+	}
+
+	conf := &ClientConfig{
+		BaseURL:   "http://127.0.0.1:8080/",
+		Username:  "username",
+		Password:  "password",
+		VerifySSL: false,
+		Transport: transport,
+	}
+
+	client := NewClient(conf)
+	R := RTFactory{}
+	_, _, err := R.UpdateRepo(context.TODO(), &client, "test-repo-local", GenericRepoConfig{Key: "test-repo-local", RClass: "local", BlackedOut: true}, nil)
+	if err != nil {
+		t.Fatalf("UpdateRepo() error = %v", err)
+	}
+	if method != "POST" {
+		t.Errorf("UpdateRepo() method = %v, want POST", method)
+	}
+	var sent GenericRepoConfig
+	if err := json.Unmarshal(buf.Bytes(), &sent); err != nil || !sent.BlackedOut {
+		t.Errorf("UpdateRepo() sent %v", buf.String())
+	}
+}
+
 func TestRTFactory_DeleteRepo(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
@@ -393,7 +438,7 @@ func TestRTFactory_DeleteRepo(t *testing.T) {
 			R := RTFactory{
 				rtInterface: tt.fields.rtInterface,
 			}
-			_, _, err := R.DeleteRepo(&client, tt.args.key)
+			_, _, err := R.DeleteRepo(context.TODO(), &client, tt.args.key)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeleteRepo() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// TLS versions by the name used in the configuration
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion returns the TLS version for a name like 1.2, an empty name is the Go default
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, it must be one of 1.0, 1.1, 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// Whether the certificate of Artifactory is verified. A CA bundle is only configured to verify it, so it turns
+// the verification on without VerifySSL.
+func (conf *ClientConfig) verifyCertificate() bool {
+	return conf.VerifySSL || len(conf.CACert) > 0
+}
+
+// TLS settings for the connections to Artifactory
+func (conf *ClientConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: !conf.verifyCertificate(), MinVersion: conf.MinTLSVersion}
+	if len(conf.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(conf.CACert) {
+			return nil, errors.New("the CA bundle contains no PEM encoded certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(conf.ClientCert) > 0 || len(conf.ClientKey) > 0 {
+		if len(conf.ClientCert) == 0 || len(conf.ClientKey) == 0 {
+			return nil, errors.New("the client certificate and key must be set together")
+		}
+		cert, err := tls.X509KeyPair(conf.ClientCert, conf.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Proxy for the requests to Artifactory. The proxy environment variables are used for what isn't set in the config.
+func (conf *ClientConfig) proxy() (func(*http.Request) (*url.URL, error), error) {
+	proxyConfig := httpproxy.FromEnvironment()
+	if conf.ProxyURL != "" {
+		u, err := url.Parse(conf.ProxyURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+			return nil, errors.New("the proxy url must be an http, https or socks5 url")
+		}
+		proxyConfig.HTTPProxy, proxyConfig.HTTPSProxy = conf.ProxyURL, conf.ProxyURL
+	}
+	if conf.NoProxy != "" {
+		proxyConfig.NoProxy = conf.NoProxy
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Self-signed client certificate and key in PEM
+func testClientCertificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "repo-operator"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	if v, err := ParseTLSVersion("1.2"); err != nil || v != tls.VersionTLS12 {
+		t.Errorf("ParseTLSVersion(1.2) = %v, %v", v, err)
+	}
+	if v, err := ParseTLSVersion(""); err != nil || v != 0 {
+		t.Errorf("ParseTLSVersion() = %v, %v, want the default", v, err)
+	}
+	if _, err := ParseTLSVersion("TLS1.2"); err == nil {
+		t.Error("ParseTLSVersion(TLS1.2) = nil, want an error")
+	}
+}
+
+func TestNewClientMutualTLS(t *testing.T) {
+	clientCert, clientKey := testClientCertificate(t)
+	block, _ := pem.Decode(clientCert)
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(parsed)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	conf := &ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodToken, Token: "token", VerifySSL: true, CACert: caCert, ClientCert: clientCert, ClientKey: clientKey}
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	client := NewClient(conf)
+	if _, err := client.Client.Get(server.URL); err != nil {
+		t.Errorf("Get() = %v, want the client certificate to be accepted", err)
+	}
+	withoutCert := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodToken, Token: "token", VerifySSL: true, CACert: caCert})
+	if _, err := withoutCert.Client.Get(server.URL); err == nil {
+		t.Error("Get() = nil, want the server to require a client certificate")
+	}
+	tls13 := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodToken, Token: "token", VerifySSL: true, CACert: caCert,
+		ClientCert: clientCert, ClientKey: clientKey, MinTLSVersion: tls.VersionTLS13})
+	if _, err := tls13.Client.Get(server.URL); err == nil {
+		t.Error("Get() = nil, want TLS 1.2 to be refused with a minimum of 1.3")
+	}
+}
+
+func TestCABundleVerifiesCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	otherCA, _ := testClientCertificate(t)
+
+	trusted := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodToken, Token: "token", CACert: caCert})
+	if _, err := trusted.Client.Get(server.URL); err != nil {
+		t.Errorf("Get() = %v, want the certificate to be verified with the CA bundle", err)
+	}
+	untrusted := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodToken, Token: "token", CACert: otherCA})
+	if _, err := untrusted.Client.Get(server.URL); err == nil {
+		t.Error("Get() = nil, want a certificate which isn't signed by the CA bundle to be refused without verifySSL")
+	}
+	unverified := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodToken, Token: "token"})
+	if _, err := unverified.Client.Get(server.URL); err != nil {
+		t.Errorf("Get() = %v, want the certificate not to be verified without verifySSL or a CA bundle", err)
+	}
+}
+
+func TestClientConfigProxy(t *testing.T) {
+	conf := &ClientConfig{ProxyURL: "http://proxy.example.com:3128", NoProxy: ".internal.example.com"}
+	proxy, err := conf.proxy()
+	if err != nil {
+		t.Fatalf("proxy() = %v", err)
+	}
+	req, _ := http.NewRequest("GET", "https://artifactory.example.com/artifactory/api/repositories", nil)
+	if u, err := proxy(req); err != nil || u == nil || u.Host != "proxy.example.com:3128" {
+		t.Errorf("proxy() = %v, %v, want the configured proxy", u, err)
+	}
+	req, _ = http.NewRequest("GET", "https://artifactory.internal.example.com/artifactory", nil)
+	if u, err := proxy(req); err != nil || u != nil {
+		t.Errorf("proxy() = %v, %v, want no proxy for a NO_PROXY host", u, err)
+	}
+}
+
+func TestClientConfigValidateTLSAndProxy(t *testing.T) {
+	clientCert, _ := testClientCertificate(t)
+	tests := []struct {
+		name    string
+		conf    ClientConfig
+		wantErr string
+	}{
+		{name: "Test the key is required with the certificate", conf: ClientConfig{ClientCert: clientCert}, wantErr: "set together"},
+		{name: "Test the key must match the certificate", conf: ClientConfig{ClientCert: clientCert, ClientKey: []byte("key")}, wantErr: "invalid client certificate"},
+		{name: "Test the proxy must be a url", conf: ClientConfig{ProxyURL: "proxy.example.com:3128"}, wantErr: "proxy url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.BaseURL, conf.AuthMethod, conf.Token = "https://artifactory", AuthMethodToken, "token"
+			if err := conf.Validate(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authentication methods of the client
+const (
+	// AuthMethodBasic sends the username and password
+	AuthMethodBasic = "basic"
+	// AuthMethodToken sends the API key in the X-JFrog-Art-Api header, it's deprecated by JFrog
+	AuthMethodToken = "token"
+	// AuthMethodBearer sends an access token in the Authorization header
+	AuthMethodBearer = "bearer"
+)
+
+// An access token is refreshed this long before it expires
+const tokenRefreshMargin = time.Minute
+
+// Path of the access token API
+const tokenPath = "/api/security/token"
+
+// tokenResponse is the response of the access token API
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	TokenType    string `json:"token_type,omitempty"`
+}
+
+// accessTokens holds the current access token of a client and refreshes it before it expires.
+// It's shared by the copies of a client.
+type accessTokens struct {
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiry       time.Time
+}
+
+func newAccessTokens(accessToken string, refreshToken string) *accessTokens {
+	return &accessTokens{accessToken: accessToken, refreshToken: refreshToken, expiry: tokenExpiry(accessToken)}
+}
+
+// token returns an access token which is valid for the request, it's refreshed when it's about to expire.
+// An expired token which can't be refreshed is an ErrTokenExpired.
+func (t *accessTokens) token(ctx context.Context, c *Client) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.expiry.IsZero() || time.Now().Add(tokenRefreshMargin).Before(t.expiry) {
+		return t.accessToken, nil
+	}
+	expired := !time.Now().Before(t.expiry)
+	if t.refreshToken == "" {
+		if expired {
+			return "", fmt.Errorf("%w at %s and no refresh token is configured", ErrTokenExpired, t.expiry.Format(time.RFC3339))
+		}
+		return t.accessToken, nil
+	}
+	refreshed, err := refreshAccessToken(ctx, c, t.accessToken, t.refreshToken)
+	if err != nil {
+		if expired {
+			return "", fmt.Errorf("%w at %s, refreshing it failed: %v", ErrTokenExpired, t.expiry.Format(time.RFC3339), err)
+		}
+		// The current token is still valid, the refresh is tried again by the next request
+		log.Error(err, "Failed to refresh the access token", "expiry", t.expiry)
+		return t.accessToken, nil
+	}
+	t.accessToken = refreshed.AccessToken
+	if refreshed.RefreshToken != "" {
+		t.refreshToken = refreshed.RefreshToken
+	}
+	t.expiry = tokenExpiry(refreshed.AccessToken)
+	if t.expiry.IsZero() && refreshed.ExpiresIn > 0 {
+		t.expiry = time.Now().Add(time.Duration(refreshed.ExpiresIn) * time.Second)
+	}
+	log.Info("Refreshed the access token", "expiry", t.expiry)
+	if c.Config.TokensRefreshed != nil {
+		c.Config.TokensRefreshed(t.accessToken, t.refreshToken)
+	}
+	return t.accessToken, nil
+}
+
+// Exchange the refresh token for a new access token. The request isn't authenticated with the access token,
+// so that an expired one can be refreshed.
+func refreshAccessToken(ctx context.Context, c *Client, accessToken string, refreshToken string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("access_token", accessToken)
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(c.Config.BaseURL, "/")+tokenPath, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("user-agent", "artifactory-go."+VERSION)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	debug := c.debugEnabled(ctx)
+	if debug {
+		logRequest(req, []byte(form.Encode()))
+	}
+	start := time.Now()
+	r, err := c.Client.Do(req)
+	code := 0
+	if err == nil {
+		code = r.StatusCode
+	}
+	observeRequest("POST", tokenPath, code, start)
+	if debug {
+		logResponse(req, code, start, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _, _, err := parseResponse(r)
+	if err != nil {
+		return nil, err
+	}
+	refreshed := &tokenResponse{}
+	if err := json.Unmarshal(data, refreshed); err != nil {
+		return nil, fmt.Errorf("parsing the access token response: %w", err)
+	}
+	if refreshed.AccessToken == "" {
+		return nil, fmt.Errorf("the access token response has no access token")
+	}
+	return refreshed, nil
+}
+
+// CreateToken creates an access token for the username with the scope, which expires after expiresIn.
+// The user doesn't have to exist when the scope names the groups of the token.
+func (R RTFactory) CreateToken(ctx context.Context, c *Client, username string, scope string, expiresIn time.Duration) (tokenResponse, int, string, error) {
+	var res tokenResponse
+	form := url.Values{}
+	form.Set("username", username)
+	form.Set("scope", scope)
+	form.Set("expires_in", strconv.FormatInt(int64(expiresIn/time.Second), 10))
+	data, code, status, err := Post(ctx, c, tokenPath, []byte(form.Encode()), map[string]string{"content-type": "application/x-www-form-urlencoded"})
+	if err != nil {
+		return res, code, status, err
+	}
+	err = json.Unmarshal(data, &res)
+	return res, code, status, err
+}
+
+// Expiry of an access token from the exp claim of the JWT, the zero time when the token doesn't expire
+// or isn't a JWT. The signature isn't verified, Artifactory does that.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Unsigned JWT which expires at exp
+func testJWT(exp time.Time) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"RS256"}`)) + "." + enc.EncodeToString([]byte(fmt.Sprintf(`{"sub":"repo-operator","exp":%d}`, exp.Unix()))) + ".signature"
+}
+
+func Test_tokenExpiry(t *testing.T) {
+	exp := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	if got := tokenExpiry(testJWT(exp)); !got.Equal(exp) {
+		t.Errorf("tokenExpiry() = %v, want %v", got, exp)
+	}
+	if got := tokenExpiry("AKCp5bBXy"); !got.IsZero() {
+		t.Errorf("tokenExpiry() = %v for an API key, want the zero time", got)
+	}
+}
+
+func TestBearerTokenIsSent(t *testing.T) {
+	token := testJWT(time.Now().Add(time.Hour))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token || r.Header.Get("X-JFrog-Art-Api") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodBearer, Token: token})
+	if _, code, _, err := Get(context.TODO(), &client, "/api/repositories", nil); err != nil || code != http.StatusOK {
+		t.Errorf("Get() = %v, %v, want the bearer token to be accepted", code, err)
+	}
+}
+
+func TestAccessTokenIsRefreshedBeforeExpiry(t *testing.T) {
+	expiring := testJWT(time.Now().Add(30 * time.Second))
+	refreshed := testJWT(time.Now().Add(time.Hour))
+	var refreshes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == tokenPath {
+			atomic.AddInt32(&refreshes, 1)
+			if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh-1" || r.FormValue("access_token") != expiring {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"access_token":%q,"refresh_token":"refresh-2","expires_in":3600,"token_type":"Bearer"}`, refreshed)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+refreshed {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	saved := []string{}
+	client := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodBearer, Token: expiring, RefreshToken: "refresh-1",
+		TokensRefreshed: func(accessToken string, refreshToken string) { saved = append(saved, accessToken, refreshToken) }})
+	for i := 0; i < 2; i++ {
+		if _, code, _, err := Get(context.TODO(), &client, "/api/repositories", nil); err != nil || code != http.StatusOK {
+			t.Fatalf("Get() = %v, %v, want the refreshed token to be used", code, err)
+		}
+	}
+	if n := atomic.LoadInt32(&refreshes); n != 1 {
+		t.Errorf("refreshed %d times, want once", n)
+	}
+	if client.tokens.refreshToken != "refresh-2" {
+		t.Errorf("refresh token = %q, want the one returned by the refresh", client.tokens.refreshToken)
+	}
+	if !reflect.DeepEqual(saved, []string{refreshed, "refresh-2"}) {
+		t.Errorf("TokensRefreshed() got %v, want the refreshed tokens once", saved)
+	}
+}
+
+func TestExpiredAccessToken(t *testing.T) {
+	expired := testJWT(time.Now().Add(-time.Minute))
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	conf := &ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodBearer, Token: expired}
+	if err := conf.Validate(); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Validate() = %v, want ErrTokenExpired", err)
+	}
+	client := NewClient(conf)
+	if _, _, _, err := Get(context.TODO(), &client, "/api/repositories", nil); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Get() = %v, want ErrTokenExpired without a refresh token", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("sent %d requests, want none with an expired token", n)
+	}
+
+	client = NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodBearer, Token: expired, RefreshToken: "revoked"})
+	if _, _, _, err := Get(context.TODO(), &client, "/api/repositories", nil); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Get() = %v, want ErrTokenExpired when the refresh fails", err)
+	}
+}
+
+func TestCreateToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != tokenPath || r.FormValue("username") != "test-repo-user" || r.FormValue("scope") != "member-of-groups:test-repo-group" || r.FormValue("expires_in") != "3600" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"access_token":"access-token","expires_in":3600,"token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(&ClientConfig{BaseURL: server.URL, AuthMethod: AuthMethodBasic, Username: "admin", Password: "password"})
+	res, _, _, err := client.rt.CreateToken(context.TODO(), &client, "test-repo-user", "member-of-groups:test-repo-group", time.Hour)
+	if err != nil || res.AccessToken != "access-token" {
+		t.Errorf("CreateToken() = %+v, %v, want the access token", res, err)
+	}
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultMaxRetries is how often an idempotent request is retried after a transient failure
+	DefaultMaxRetries = 3
+	// DefaultRateLimit is the number of requests per second sent to Artifactory by all reconcile workers together
+	DefaultRateLimit = 20
+	// DefaultRateBurst is the number of requests which may be sent at once before the rate limit applies
+	DefaultRateBurst = 40
+
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// retryTransport retries idempotent requests which failed with a transient error and limits the request rate
+type retryTransport struct {
+	next       http.RoundTripper
+	limiter    *rate.Limiter
+	maxRetries int
+	// sleep waits for the given time or until the request is cancelled, it's replaced in tests
+	sleep func(req *http.Request, d time.Duration) error
+}
+
+// Create a transport which rate limits every request and retries idempotent ones
+func newRetryTransport(next http.RoundTripper, maxRetries int, ratePerSecond float64, burst int) *retryTransport {
+	limit := rate.Inf
+	if ratePerSecond > 0 {
+		limit = rate.Limit(ratePerSecond)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &retryTransport{
+		next:       next,
+		limiter:    rate.NewLimiter(limit, burst),
+		maxRetries: maxRetries,
+		sleep:      sleepContext,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attemptReq := req
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+		resp, err := t.next.RoundTrip(attemptReq)
+		if attempt >= t.maxRetries || !isIdempotent(req.Method) || req.Context().Err() != nil || !isTransient(resp, err) {
+			return resp, err
+		}
+		delay := backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+			_ = resp.Body.Close()
+		}
+		retriesTotal.WithLabelValues(endpointLabel(req.URL.Path), req.Method).Inc()
+		log.Info("Retrying Artifactory request", "method", req.Method, "path", req.URL.Path, "attempt", attempt+1, "delay", delay.String())
+		if err := t.sleep(req, delay); err != nil {
+			return nil, err
+		}
+		// The request must not be modified, the retry is sent as a copy with a fresh body
+		attemptReq = req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+	}
+}
+
+// Only requests which can safely be sent twice are retried, a POST is a partial update of a config
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Connection errors, throttling and unavailable gateways are worth another try
+func isTransient(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Exponential backoff with jitter: a random delay between half and the full exponential delay
+func backoff(attempt int) time.Duration {
+	d := retryBaseDelay << uint(attempt)
+	if d > retryMaxDelay || d <= 0 {
+		d = retryMaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Delay requested by the server in the Retry-After header, in seconds or as an http date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		d = time.Until(date)
+	} else {
+		return 0, false
+	}
+	if d < 0 {
+		d = 0
+	}
+	if d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d, true
+}
+
+// Wait for the delay unless the request is cancelled first
+func sleepContext(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Server failing with the given status codes before it answers 200, it records the request bodies
+type flakyServer struct {
+	codes      []int
+	retryAfter string
+	bodies     []string
+}
+
+func (f *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.bodies = append(f.bodies, string(body))
+	if len(f.bodies) <= len(f.codes) {
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		w.WriteHeader(f.codes[len(f.bodies)-1])
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		codes        []int
+		retryAfter   string
+		wantAttempts int
+		wantCode     int
+		wantDelays   []time.Duration
+	}{
+		{name: "GET is retried on 503", method: http.MethodGet, codes: []int{503, 502}, wantAttempts: 3, wantCode: 200},
+		{name: "PUT is retried with the same body", method: http.MethodPut, codes: []int{504}, wantAttempts: 2, wantCode: 200},
+		{name: "DELETE gives up after the retries", method: http.MethodDelete, codes: []int{503, 503, 503, 503, 503}, wantAttempts: 3, wantCode: 503},
+		{name: "POST is not retried", method: http.MethodPost, codes: []int{503}, wantAttempts: 1, wantCode: 503},
+		{name: "Client errors are not retried", method: http.MethodGet, codes: []int{404}, wantAttempts: 1, wantCode: 404},
+		{name: "Retry-After is honoured", method: http.MethodGet, codes: []int{429}, retryAfter: "3", wantAttempts: 2, wantCode: 200, wantDelays: []time.Duration{3 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyServer{codes: tt.codes, retryAfter: tt.retryAfter}
+			server := httptest.NewServer(flaky)
+			defer server.Close()
+
+			transport := newRetryTransport(http.DefaultTransport, 2, 0, 0)
+			delays := []time.Duration{}
+			transport.sleep = func(req *http.Request, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}
+			req, _ := http.NewRequest(tt.method, server.URL+"/api/repositories/test-repo", bytes.NewReader([]byte(`{"key":"test-repo"}`)))
+			resp, err := (&http.Client{Transport: transport}).Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("Do() code = %v, want %v", resp.StatusCode, tt.wantCode)
+			}
+			if len(flaky.bodies) != tt.wantAttempts {
+				t.Errorf("Do() attempts = %v, want %v", len(flaky.bodies), tt.wantAttempts)
+			}
+			for _, body := range flaky.bodies {
+				if body != `{"key":"test-repo"}` {
+					t.Errorf("Do() sent body %q", body)
+				}
+			}
+			if tt.wantDelays != nil && (len(delays) != len(tt.wantDelays) || delays[0] != tt.wantDelays[0]) {
+				t.Errorf("Do() waited %v, want %v", delays, tt.wantDelays)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// One request per minute, the second request has to wait longer than its deadline
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport, 0, 1.0/60, 1)}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("first request error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req.WithContext(ctx)); err == nil {
+		t.Errorf("second request was not rate limited")
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		d := backoff(attempt)
+		max := retryBaseDelay << uint(attempt)
+		if max > retryMaxDelay {
+			max = retryMaxDelay
+		}
+		if d < max/2 || d > max {
+			t.Errorf("backoff(%v) = %v, want between %v and %v", attempt, d, max/2, max)
+		}
+	}
+}
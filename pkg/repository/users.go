@@ -1,8 +1,8 @@
 package repository
 
 import (
+	"context"
 	"encoding/json"
-	"math/rand"
 	"time"
 )
 
@@ -47,9 +47,9 @@ type RepositoryUser struct {
 }
 
 // GetUser : Get user
-func (R RTFactory) GetUser(c *Client, key string, q map[string]string) (RepositoryUser, int, string, error) {
+func (R RTFactory) GetUser(ctx context.Context, c *Client, key string, q map[string]string) (RepositoryUser, int, string, error) {
 	var res RepositoryUser
-	userDetails, code, status, err := Get(c, "/api/security/users/"+key, q)
+	userDetails, code, status, err := Get(ctx, c, "/api/security/users/"+key, q)
 	if err != nil {
 		return res, 500, statusInternalServerErrorState, err
 	}
@@ -58,44 +58,31 @@ func (R RTFactory) GetUser(c *Client, key string, q map[string]string) (Reposito
 }
 
 // CreateUser creates a user with the specified details
-func (R RTFactory) CreateUser(c *Client, key string, u UserDetails, q map[string]string) (int, string, error) {
+func (R RTFactory) CreateUser(ctx context.Context, c *Client, key string, u UserDetails, q map[string]string) (int, string, error) {
 	code := 0
 	status := ""
 	j, err := json.Marshal(u)
 	if err != nil {
 		return 500, statusInternalServerErrorState, err
 	}
-	_, code, status, err = Put(c, "/api/security/users/"+key, j, q)
+	_, code, status, err = Put(ctx, c, "/api/security/users/"+key, j, q)
+	return code, status, err
+}
+
+// UpdateUser updates the details of an existing user, fields which are not set are left as they are
+func (R RTFactory) UpdateUser(ctx context.Context, c *Client, key string, u UserDetails, q map[string]string) (int, string, error) {
+	j, err := json.Marshal(u)
+	if err != nil {
+		return 500, statusInternalServerErrorState, err
+	}
+	_, code, status, err := Post(ctx, c, "/api/security/users/"+key, j, q)
 	return code, status, err
 }
 
 // DeleteUser deletes a user
-func (R RTFactory) DeleteUser(c *Client, key string) (int, string, error) {
+func (R RTFactory) DeleteUser(ctx context.Context, c *Client, key string) (int, string, error) {
 	code := 0
 	status := ""
-	code, status, err := Delete(c, "/api/security/users/"+key)
+	code, status, err := Delete(ctx, c, "/api/security/users/"+key)
 	return code, status, err
 }
-
-// GenerateRandomPassword : Generates a Random password for internal user
-func GenerateRandomPassword() string {
-	rand.Seed(time.Now().UnixNano())
-	digits := "0123456789"
-	specials := "~=+%^*/()[]{}/!@#$?|"
-	all := "ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
-		"abcdefghijklmnopqrstuvwxyz" +
-		digits + specials
-	length := 8
-	buf := make([]byte, length)
-	buf[0] = digits[rand.Intn(len(digits))]
-	buf[1] = specials[rand.Intn(len(specials))]
-	for i := 2; i < length; i++ {
-		buf[i] = all[rand.Intn(len(all))]
-	}
-	for i := len(buf) - 1; i > 0; i-- {
-		j := rand.Intn(i + 1)
-		buf[i], buf[j] = buf[j], buf[i]
-	}
-	str := string(buf)
-	return str
-}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
@@ -56,11 +57,40 @@ func TestClient_TestCreateUser(t *testing.T) {
 	}
 
 	expectedJSON, _ := json.Marshal(user)
-	_, _, err := client.rt.CreateUser(&client, "admin", user, make(map[string]string))
+	_, _, err := client.rt.CreateUser(context.TODO(), &client, "admin", user, make(map[string]string))
 	assert.NoError(t, err, "should not return an error")
 	assert.Equal(t, string(expectedJSON), buf.String(), "should send user json")
 }
 
+func TestRTFactory_UpdateUser(t *testing.T) {
+	var method, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	transport := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(server.URL)
+		},
+	}
+
+	conf := &ClientConfig{
+		BaseURL:   "http://127.0.0.1:8080/",
+		Username:  "username",
+		Password:  "password",
+		VerifySSL: false,
+		Transport: transport,
+	}
+
+	client := NewClient(conf)
+	_, _, err := client.rt.UpdateUser(context.TODO(), &client, "testuser", UserDetails{Password: "newpass"}, make(map[string]string))
+	assert.NoError(t, err, "should not return an error")
+	assert.Equal(t, "POST", method, "should update the user with a POST")
+	assert.Equal(t, "/api/security/users/testuser", path, "should update the user")
+}
+
 func TestClient_TestCreateUserFailure(t *testing.T) {
 	conf := &ClientConfig{
 		BaseURL:   "http://127.0.0.1:8080/",
@@ -71,7 +101,7 @@ func TestClient_TestCreateUserFailure(t *testing.T) {
 
 	client := NewClient(conf)
 	var details = UserDetails{}
-	_, _, err := client.rt.CreateUser(&client, "testuser", details, make(map[string]string))
+	_, _, err := client.rt.CreateUser(context.TODO(), &client, "testuser", details, make(map[string]string))
 	assert.Error(t, err, "should return an error")
 }
 
@@ -101,7 +131,7 @@ func TestClient_TestDeleteUser(t *testing.T) {
 	}
 
 	client := NewClient(conf)
-	_, _, err := client.rt.DeleteUser(&client, "testuser")
+	_, _, err := client.rt.DeleteUser(context.TODO(), &client, "testuser")
 	assert.NoError(t, err, "should not return an error")
 }
 
@@ -165,7 +195,7 @@ func TestRTFactory_GetUser(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, _, _, err := client.rt.GetUser(&client, tt.args.key, tt.args.q)
+			got, _, _, err := client.rt.GetUser(context.TODO(), &client, tt.args.key, tt.args.q)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetUser() error = %v, wantErr %v", err, tt.wantErr)
 				return